@@ -1,41 +1,115 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/edumar111/my-geth-edu/core"
 	"github.com/edumar111/my-geth-edu/p2p"
 	"github.com/edumar111/my-geth-edu/rpc"
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
 	"log"
+	"math/big"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
+// datadirUsage es la ayuda del flag --datadir, común a todos los comandos
+const datadirUsage = "Directorio de datos del nodo (vacío: base de datos en memoria)"
+
 func InitCmd() *cobra.Command {
-	return &cobra.Command{
+	var datadir string
+
+	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Inicializa el bloque génesis",
 		Run: func(cmd *cobra.Command, args []string) {
-			// Lógica para crear y almacenar el bloque génesis en disco
-			log.Println("Genesis block created!")
+			// Abrir la cadena escribe el génesis si el datadir está vacío
+			db, err := storage.Open(datadir)
+			if err != nil {
+				log.Fatal("Error al abrir la base de datos:", err)
+			}
+			defer db.Close()
+			blockchain, err := core.NewBlockchain(db, core.DefaultGenesis(), nil)
+			if err != nil {
+				log.Fatal("Error al inicializar la cadena:", err)
+			}
+			log.Printf("Genesis block ready: %s (head #%d)\n",
+				blockchain.Genesis().Hash().Hex(), blockchain.CurrentBlock().Header.BlockNumber)
 		},
 	}
+
+	cmd.Flags().StringVar(&datadir, "datadir", "", datadirUsage)
+
+	return cmd
 }
 
 func RunCmd() *cobra.Command {
 	var p2pPort int
 	var rpcHTTPPort int
 	var rpcWSPort int
+	var blockTime time.Duration
+	var maxTxsPerBlock int
+	var gasLimit uint64
+	var coinbase string
+	var chainID uint64
+	var allowUnprotected bool
+	var datadir string
+	var gcmode string
+	var stateHistory uint64
 
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Inicia el nodo",
 		Run: func(cmd *cobra.Command, args []string) {
-			// 1. Cargar génesis (o cargar de disco)
-			genesis := core.CreateGenesisBlock()
-			log.Printf("Genesis block hash: %s\n", genesis.Hash())
+			if blockTime <= 0 {
+				log.Fatalf("Invalid --block-time %v, must be greater than zero", blockTime)
+			}
+			if maxTxsPerBlock <= 0 {
+				log.Fatalf("Invalid --block-max-txs %d, must be at least 1", maxTxsPerBlock)
+			}
+
+			// 1. Abrir la base de datos y la blockchain: si el datadir ya tiene
+			// una cadena se continúa desde su cabeza, si no se escribe el génesis
+			db, err := storage.Open(datadir)
+			if err != nil {
+				log.Fatal("Error al abrir la base de datos:", err)
+			}
+			defer db.Close()
+			genesis := core.DefaultGenesis()
+			genesis.Config.ChainID = new(big.Int).SetUint64(chainID)
+			cacheConfig := *core.DefaultCacheConfig
+			switch gcmode {
+			case "full":
+			case "archive":
+				cacheConfig.Archive = true
+			default:
+				log.Fatalf("Invalid --gcmode %q, want \"full\" or \"archive\"", gcmode)
+			}
+			cacheConfig.StateHistory = stateHistory
+			blockchain, err := core.NewBlockchain(db, genesis, &cacheConfig)
+			if err != nil {
+				log.Fatal("Error al cargar la cadena:", err)
+			}
+			defer blockchain.Stop() // espera a la poda en marcha antes de cerrar la base de datos
+			log.Printf("Genesis block hash: %s (chain id %d), head #%d\n",
+				blockchain.Genesis().Hash().Hex(), chainID, blockchain.CurrentBlock().Header.BlockNumber)
 
-			// 2. Creamos un State (o cargamos balances, nonces, etc.)
-			state := core.NewState()
-			// (Opcional) Asignar balances o nonces iniciales
+			// 2. Pool de transacciones pendientes y productor de bloques
+			txPool := core.NewTxPool(blockchain, core.TxPoolConfig{AllowUnprotected: allowUnprotected})
+			defer txPool.Stop()
+			producer := core.NewBlockProducer(blockchain, txPool, core.ProducerConfig{
+				BlockTime:      blockTime,
+				MaxTxsPerBlock: maxTxsPerBlock,
+				GasLimit:       gasLimit,
+				Coinbase:       common.HexToAddress(coinbase),
+			})
+			producer.Start()
+			defer producer.Stop()
 
 			// 3. Iniciar P2P
 			server, err := p2p.NewP2PServer(p2pPort)
@@ -44,31 +118,154 @@ func RunCmd() *cobra.Command {
 			}
 			defer server.Shutdown()
 
-			// 4. Creamos el RPCServer con referencia a nuestro State
+			// 4. Creamos el RPCServer con referencia a la blockchain
 			rpcServer := &rpc.RPCServer{
-				State:      state,
-				Blockchain: []*core.Block{genesis}, // Inicia la Blockchain con Génesis
+				Blockchain: blockchain,
+				TxPool:     txPool,
 			}
 			rpcServer.StartRPC(strconv.Itoa(rpcHTTPPort))
 			//go rpcServer.StartRPC(strconv.Itoa(rpcHTTPPort))
 
 			// 5. Servidor WebSocket (en "/")
 			wsServer := &rpc.RPCWSServer{
-				State:      state,
-				Blockchain: []*core.Block{genesis},
+				Blockchain: blockchain, // misma cadena y pool que el servidor HTTP
+				TxPool:     txPool,
 			}
 			wsServer.StartWS(strconv.Itoa(rpcWSPort))
 			//go rpcServer.StartWS(strconv.Itoa(rpcWSPort))
 
 			log.Printf("Node running on P2P port %d, RPC HTTP %d, WS %d", p2pPort, rpcHTTPPort, rpcWSPort)
-			select {}
+
+			// Esperamos a Ctrl+C o SIGTERM; los defer paran el productor y
+			// cierran la base de datos en orden
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			<-sigs
+			log.Println("Shutting down...")
 		},
 	}
 
 	// Definimos los flags
+	cmd.Flags().StringVar(&datadir, "datadir", "", datadirUsage)
+	cmd.Flags().StringVar(&gcmode, "gcmode", "full", "\"full\": solo el estado de los últimos bloques (el resto se poda), \"archive\": el estado de todos los bloques")
+	cmd.Flags().Uint64Var(&stateHistory, "state-history", core.DefaultStateHistory, "Bloques recientes cuyo estado se conserva en modo full")
+	cmd.Flags().Uint64Var(&chainID, "chain-id", core.DefaultChainID, "Chain ID para la protección contra replay (EIP-155)")
+	cmd.Flags().BoolVar(&allowUnprotected, "allow-unprotected-txs", false, "Acepta TXs legacy sin chain ID (V=27/28), que se pueden reproducir desde otras cadenas")
 	cmd.Flags().IntVar(&p2pPort, "p2p-port", 30303, "Puerto para P2P")
 	cmd.Flags().IntVar(&rpcHTTPPort, "rpc-http-port", 4045, "Puerto para RPC HTTP")
 	cmd.Flags().IntVar(&rpcWSPort, "rpc-ws-port", 4046, "Puerto para RPC WebSocket")
+	cmd.Flags().DurationVar(&blockTime, "block-time", core.DefaultProducerConfig.BlockTime, "Intervalo entre bloques")
+	cmd.Flags().IntVar(&maxTxsPerBlock, "block-max-txs", core.DefaultProducerConfig.MaxTxsPerBlock, "Máximo de transacciones por bloque")
+	cmd.Flags().Uint64Var(&gasLimit, "block-gas-limit", core.DefaultProducerConfig.GasLimit, "Gas límite objetivo por bloque")
+	cmd.Flags().StringVar(&coinbase, "coinbase", core.DefaultProducerConfig.Coinbase.Hex(), "Dirección que recibe las fees de los bloques producidos")
+
+	return cmd
+}
+
+// DBCmd agrupa los comandos que trabajan directamente sobre la base de datos
+// de un nodo parado.
+func DBCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Operaciones sobre la base de datos del nodo (con el nodo parado)",
+	}
+	cmd.AddCommand(stateDiffCmd())
+	cmd.AddCommand(pruneCmd())
+	return cmd
+}
+
+func stateDiffCmd() *cobra.Command {
+	var datadir string
+
+	cmd := &cobra.Command{
+		Use:   "statediff [desde] [hasta]",
+		Short: "Vuelca los cambios de estado de los bloques canónicos, un JSON por línea",
+		Long: "Vuelca los cambios de estado de los bloques canónicos entre `desde` y `hasta`\n" +
+			"(por defecto, de 0 a la cabeza) con el mismo formato que debug_stateDiff.",
+		Args: cobra.MaximumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := storage.Open(datadir)
+			if err != nil {
+				log.Fatal("Error al abrir la base de datos:", err)
+			}
+			defer db.Close()
+			head := core.ReadBlock(db, core.ReadHeadBlockHash(db))
+			if head == nil {
+				log.Fatal("La base de datos no contiene ninguna cadena")
+			}
+
+			from, to := uint64(0), head.Header.BlockNumber
+			if len(args) > 0 {
+				if from, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+					log.Fatalf("Bloque inicial inválido %q: %v", args[0], err)
+				}
+			}
+			if len(args) > 1 {
+				if to, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+					log.Fatalf("Bloque final inválido %q: %v", args[1], err)
+				}
+			}
+			if to > head.Header.BlockNumber {
+				to = head.Header.BlockNumber
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			for n := from; n <= to; n++ {
+				hash := core.ReadCanonicalHash(db, n)
+				diff := core.ReadStateDiff(db, hash, n)
+				if diff == nil {
+					// Bloques importados antes de que se guardaran los diffs
+					fmt.Fprintf(os.Stderr, "No state diff for block #%d\n", n)
+					continue
+				}
+				if err := enc.Encode(rpc.NewStateDiffResult(diff)); err != nil {
+					log.Fatal("Error al escribir el diff:", err)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&datadir, "datadir", "", datadirUsage)
+
+	return cmd
+}
+
+func pruneCmd() *cobra.Command {
+	var datadir string
+	var stateHistory uint64
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Borra el estado de los bloques fuera de la ventana --state-history",
+		Long: "Borra de la base de datos los nodos de la trie de estado que no forman parte del\n" +
+			"estado de los últimos --state-history bloques canónicos. Tras podar, el nodo ya no\n" +
+			"puede servir en modo archivo los estados borrados.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if datadir == "" {
+				log.Fatal("Falta --datadir: no hay nada que podar en una base de datos en memoria")
+			}
+			db, err := storage.Open(datadir)
+			if err != nil {
+				log.Fatal("Error al abrir la base de datos:", err)
+			}
+			defer db.Close()
+
+			start := time.Now()
+			stats, err := core.PruneDatabase(db, stateHistory)
+			if err != nil {
+				log.Fatal("Error al podar el estado:", err)
+			}
+			// Compactamos para que LevelDB devuelva el espacio al disco
+			if err := db.Compact(nil, nil); err != nil {
+				log.Fatal("Error al compactar la base de datos:", err)
+			}
+			log.Printf("Pruned %d trie nodes (%v), %d live nodes kept, took %v\n",
+				stats.Deleted, stats.Freed, stats.Live, time.Since(start))
+		},
+	}
+
+	cmd.Flags().StringVar(&datadir, "datadir", "", datadirUsage)
+	cmd.Flags().Uint64Var(&stateHistory, "state-history", core.DefaultStateHistory, "Bloques recientes cuyo estado se conserva")
 
 	return cmd
 }
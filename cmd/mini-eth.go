@@ -18,6 +18,7 @@ func main() {
 	// Subcomandos
 	rootCmd.AddCommand(cli.InitCmd())
 	rootCmd.AddCommand(cli.RunCmd())
+	rootCmd.AddCommand(cli.DBCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
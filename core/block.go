@@ -2,76 +2,104 @@
 package core
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
+	"math/big"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Block representa un bloque muy básico.
 type Block struct {
 	Header       *BlockHeader
 	Transactions []*RawTx
-	// El Merkle Root podría estar en el header o aquí según se prefiera
+	// Los recibos no viajan con el bloque (su raíz ya está en el header),
+	// la Blockchain los guarda aparte al importarlo
 }
 
 // BlockHeader información esencial de cabecera.
+// El orden de los campos define su codificación RLP canónica, no reordenar.
 type BlockHeader struct {
-	ParentHash  string
-	Timestamp   int64
-	StateRoot   string // Raíz de la Merkle Trie de estado
-	BlockNumber uint64
+	ParentHash   common.Hash
+	Timestamp    uint64
+	StateRoot    common.Hash // Raíz de la Merkle Trie de estado
+	TxRoot       common.Hash // Raíz de la trie ordenada de transacciones
+	ReceiptsRoot common.Hash // Raíz de la trie ordenada de recibos
+	BlockNumber  uint64
+	Coinbase     common.Address // Proponente del bloque, recibe las fees
+	GasLimit     uint64         // Gas máximo que pueden consumir las transacciones del bloque
+	GasUsed      uint64         // Gas consumido por las transacciones del bloque
+	BaseFee      *big.Int       // Precio mínimo por gas del bloque, se quema (EIP-1559)
 	// Podríamos tener más campos como ExtraData, Difficulty, etc.
 }
 
-// NewBlock crea un nuevo bloque y calculamos su StateRoot simplificado.
-func NewBlock(parentHash string, blockNumber uint64, txs []*RawTx, stateRoot string) *Block {
+// NewHeader prepara la cabecera de un hijo de `parent`. StateRoot, GasUsed y
+// las raíces se rellenan después de ejecutar las transacciones.
+func NewHeader(parent *Block, coinbase common.Address, gasLimit uint64) *BlockHeader {
 	header := &BlockHeader{
-		ParentHash:  parentHash,
-		Timestamp:   time.Now().Unix(),
-		BlockNumber: blockNumber,
-		StateRoot:   stateRoot,
+		ParentHash:  parent.Hash(),
+		Timestamp:   uint64(time.Now().Unix()),
+		BlockNumber: parent.Header.BlockNumber + 1,
+		Coinbase:    coinbase,
+		GasLimit:    gasLimit,
+		BaseFee:     CalcBaseFee(parent.Header),
+	}
+	// El timestamp debe crecer estrictamente respecto al padre, aunque caigan en el mismo segundo
+	if header.Timestamp <= parent.Header.Timestamp {
+		header.Timestamp = parent.Header.Timestamp + 1
 	}
+	return header
+}
+
+// NewBlock crea un nuevo bloque y calcula las raíces de sus transacciones y recibos.
+func NewBlock(header *BlockHeader, txs []*RawTx, receipts []*Receipt) *Block {
+	header.TxRoot = DeriveTxRoot(txs)
+	header.ReceiptsRoot = DeriveReceiptsRoot(receipts)
 	return &Block{
 		Header:       header,
 		Transactions: txs,
 	}
 }
 
-// Hash del bloque (ejemplo simplificado usando sha256)
-func (b *Block) Hash() string {
-	data := []byte(
-		b.Header.ParentHash +
-			string(b.Header.Timestamp) +
-			string(b.Header.BlockNumber) +
-			b.Header.StateRoot,
-	)
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
+// DeriveTxRoot calcula la raíz de la trie ordenada (clave = rlp(índice)) de las transacciones.
+func DeriveTxRoot(txs []*RawTx) common.Hash {
+	return types.DeriveSha(Transactions(txs), trie.NewStackTrie(nil))
 }
-func CreateBlock(chain []*Block, rawTxs []RawTx, stateRoot string) *Block {
 
-	var txPointers []*RawTx
-	var parentHash string
-	var blockNumber uint64
-	for _, rt := range rawTxs {
-		txCopy := rt // para evitar issues de range
-		txPointers = append(txPointers, &txCopy)
-	}
+// DeriveReceiptsRoot calcula la raíz de la trie ordenada de los recibos.
+func DeriveReceiptsRoot(receipts []*Receipt) common.Hash {
+	return types.DeriveSha(Receipts(receipts), trie.NewStackTrie(nil))
+}
 
-	if len(chain) == 0 {
-		// Génesis
-		parentHash = "0x000000000000000"
-		blockNumber = 0
-	} else {
-		parentHash = chain[len(chain)-1].Hash()
-		blockNumber = uint64(len(chain))
+// Hash de la cabecera: keccak256(rlp(header)), igual que en Ethereum.
+func (h *BlockHeader) Hash() common.Hash {
+	enc, err := rlp.EncodeToBytes(h)
+	if err != nil {
+		// Todos los campos son codificables, no debería ocurrir
+		panic(fmt.Sprintf("can't encode block header: %v", err))
 	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// Hash del bloque, es el hash de su cabecera.
+func (b *Block) Hash() common.Hash {
+	return b.Header.Hash()
+}
 
-	// Crear el bloque
-	block := NewBlock(parentHash, blockNumber, txPointers, stateRoot)
-	// (Opcional) Añadir otra lógica de consenso, sellado, etc.
-	// Anexar el bloque a tu chain
-	fmt.Printf("Block: %+v\n", block)
-	return block
+// EncodeBlock serializa el bloque completo (cabecera y transacciones) en RLP.
+func EncodeBlock(b *Block) ([]byte, error) {
+	return rlp.EncodeToBytes(b)
+}
+
+// DecodeBlock reconstruye un bloque a partir de su codificación RLP.
+func DecodeBlock(data []byte) (*Block, error) {
+	var b Block
+	if err := rlp.DecodeBytes(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
 }
@@ -0,0 +1,669 @@
+// core/blockchain.go
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+var (
+	ErrKnownBlock       = errors.New("block already known")
+	ErrGenesisMismatch  = errors.New("database contains a different genesis")
+	ErrMissingHeadBlock = errors.New("head block missing from database")
+
+	ErrStateNotAvailable = errors.New("historical state not available")
+)
+
+// DefaultStateHistory es cuántos bloques recientes tienen su estado disponible
+// fuera del modo archivo.
+const DefaultStateHistory = 128
+
+// historicalStateCache es cuántos estados antiguos abiertos de disco se
+// mantienen en memoria, para que consultas seguidas al mismo bloque no
+// reconstruyan el estado cada vez.
+const historicalStateCache = 16
+
+// CacheConfig decide cuánto estado histórico conserva y sirve la cadena.
+type CacheConfig struct {
+	// Archive conserva los nodos de la trie de todos los bloques, así el
+	// estado tras cualquier bloque se puede consultar a partir de su StateRoot
+	Archive bool
+	// StateHistory es cuántos bloques recientes mantienen su estado en
+	// memoria; fuera del modo archivo tampoco se sirven estados más antiguos
+	StateHistory uint64
+	// GCInterval es cada cuántos bloques se borran de disco los nodos que ya
+	// no usa ningún estado de los últimos StateHistory bloques. Con 0 no se
+	// poda nunca; en modo archivo se ignora.
+	GCInterval uint64
+}
+
+// DefaultCacheConfig es la configuración de un nodo "full": solo el estado
+// reciente, y el antiguo se poda de disco.
+var DefaultCacheConfig = &CacheConfig{StateHistory: DefaultStateHistory, GCInterval: DefaultGCInterval}
+
+// ChainHeadEvent se emite cada vez que cambia la cabeza canónica.
+type ChainHeadEvent struct {
+	Block *Block
+	// Dropped son, en un reorg, las TXs de la rama abandonada que la nueva no
+	// incluye: el pool las vuelve a aceptar para que no se pierdan
+	Dropped []*RawTx
+}
+
+// Blockchain guarda todos los bloques conocidos (canónicos y laterales) con
+// sus recibos, el índice canónico número -> hash, el índice hash de TX ->
+// (bloque, posición) de la cadena canónica y el estado tras cada bloque.
+//
+// Regla de fork choice: gana la cadena más larga; en caso de empate se
+// mantiene la cabeza actual (la primera que vimos).
+//
+// Todo bloque importado se guarda en `db` junto con sus recibos, su estado y
+// los cambios que hizo en el estado (StateDiff),
+// y los índices canónicos y el puntero a la cabeza se mantienen al día, así
+// que al reiniciar el nodo continúa donde se quedó.
+type Blockchain struct {
+	mu sync.RWMutex
+
+	db          storage.KeyValueStore
+	statedb     *StateDatabase
+	cacheConfig *CacheConfig
+	historical  *lru.Cache[common.Hash, *State] // estados antiguos abiertos de disco
+	lastGC      uint64                          // altura de la cabeza en la última poda
+	pruneWG     sync.WaitGroup                  // poda en marcha en segundo plano
+	stopped     bool                            // Stop ya se llamó: no se empiezan más podas
+
+	config    *ChainConfig
+	genesis   *Block
+	head      *Block
+	blocks    map[common.Hash]*Block        // todos los bloques por hash
+	canonical map[uint64]common.Hash        // número -> hash de la cadena canónica
+	states    map[common.Hash]*State        // estado resultante de los bloques recientes
+	receipts  map[common.Hash]Receipts      // recibos de cada bloque
+	txLookup  map[common.Hash]TxLookupEntry // hash de TX -> posición en la cadena canónica
+
+	// state es el estado vivo de la cabeza, compartido con RPC y demás subsistemas
+	state *State
+
+	headFeed event.Feed
+}
+
+// blockIndex da acceso a los bloques sin tomar el lock, para ejecutar un
+// bloque desde InsertBlock (que ya tiene bc.mu).
+type blockIndex map[common.Hash]*Block
+
+// GetHeader implementa ChainContext.
+func (idx blockIndex) GetHeader(hash common.Hash) *BlockHeader {
+	if block := idx[hash]; block != nil {
+		return block.Header
+	}
+	return nil
+}
+
+// TxLookupEntry indica dónde está una transacción de la cadena canónica.
+type TxLookupEntry struct {
+	BlockHash common.Hash
+	Index     uint64
+}
+
+// NewBlockchain abre la cadena guardada en `db`. Si la base de datos está
+// vacía escribe el génesis; si no, comprueba que su génesis coincide y carga
+// la cadena canónica hasta la cabeza guardada.
+// Si el génesis no trae configuración se usa DefaultChainConfig, y si no se
+// pasa cacheConfig, DefaultCacheConfig. Un génesis que no pasa Validate se rechaza.
+func NewBlockchain(db storage.KeyValueStore, genesis *Genesis, cacheConfig *CacheConfig) (*Blockchain, error) {
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	config := genesis.Config
+	if config == nil {
+		config = DefaultChainConfig()
+	}
+	if cacheConfig == nil {
+		cacheConfig = DefaultCacheConfig
+	}
+	block := genesis.ToBlock()
+	hash := block.Hash()
+
+	bc := &Blockchain{
+		db:          db,
+		statedb:     NewStateDatabase(db),
+		cacheConfig: cacheConfig,
+		historical:  lru.NewCache[common.Hash, *State](historicalStateCache),
+		config:      config,
+		genesis:     block,
+		blocks:      make(map[common.Hash]*Block),
+		canonical:   make(map[uint64]common.Hash),
+		states:      make(map[common.Hash]*State),
+		receipts:    make(map[common.Hash]Receipts),
+		txLookup:    make(map[common.Hash]TxLookupEntry),
+	}
+
+	stored := ReadCanonicalHash(db, 0)
+	if stored == (common.Hash{}) {
+		if err := bc.writeGenesis(genesis, block); err != nil {
+			return nil, err
+		}
+	} else if stored != hash {
+		return nil, fmt.Errorf("%w: have %s, want %s", ErrGenesisMismatch, stored.Hex(), hash.Hex())
+	}
+	if err := bc.loadChain(); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// writeGenesis guarda el bloque 0, su estado y los índices de una cadena nueva.
+func (bc *Blockchain) writeGenesis(genesis *Genesis, block *Block) error {
+	state, err := genesis.toState(bc.statedb)
+	if err != nil {
+		return err
+	}
+	// El diff del génesis parte del estado vacío: son todas las cuentas del alloc
+	diff := &StateDiff{BlockHash: block.Hash(), Accounts: diffStates(newState(bc.statedb), state)}
+	if _, err := state.Commit(); err != nil {
+		return fmt.Errorf("commit genesis state: %w", err)
+	}
+	batch := bc.db.NewBatch()
+	if err := writeBlock(batch, block, Receipts{}, diff); err != nil {
+		return err
+	}
+	if err := writeCanonical(batch, []*Block{block}); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("write genesis: %w", err)
+	}
+	return nil
+}
+
+// loadChain carga en memoria la cadena canónica guardada, sus recibos y el
+// estado de la cabeza. Los estados de bloques anteriores se abren de disco
+// cuando se necesitan (stateAt). Los bloques laterales no se cargan: siguen en
+// disco y se leen cuando se piden o cuando llega un hijo suyo (loadBlock).
+func (bc *Blockchain) loadChain() error {
+	headHash := ReadHeadBlockHash(bc.db)
+	head := ReadBlock(bc.db, headHash)
+	if head == nil {
+		return fmt.Errorf("%w: %s", ErrMissingHeadBlock, headHash.Hex())
+	}
+	for n := uint64(0); n <= head.Header.BlockNumber; n++ {
+		block := ReadBlock(bc.db, ReadCanonicalHash(bc.db, n))
+		if block == nil {
+			return fmt.Errorf("%w: canonical block #%d", ErrMissingHeadBlock, n)
+		}
+		hash := block.Hash()
+		bc.blocks[hash] = block
+		bc.receipts[hash] = ReadReceipts(bc.db, block)
+		bc.setCanonical(block)
+	}
+
+	bc.head = head
+	state, err := OpenState(bc.statedb, head.Header.StateRoot)
+	if err != nil {
+		return fmt.Errorf("state of head block #%d: %w", head.Header.BlockNumber, err)
+	}
+	bc.states[headHash] = state
+	bc.state = state.Copy()
+	if head.Header.BlockNumber > 0 {
+		log.Printf("Loaded chain from database, head #%d %s\n", head.Header.BlockNumber, headHash.Hex())
+	}
+	return nil
+}
+
+// loadBlock devuelve el bloque `hash` aunque no esté en memoria. Al arrancar
+// solo se carga la cadena canónica, así que un bloque lateral guardado antes
+// de reiniciar se lee de disco, con sus recibos y con los ancestros laterales
+// que falten, hasta enlazar con un bloque en memoria: así un hijo suyo puede
+// importarse y provocar un reorg. Se llama con bc.mu tomado para escribir.
+func (bc *Blockchain) loadBlock(hash common.Hash) *Block {
+	if block, ok := bc.blocks[hash]; ok {
+		return block
+	}
+	block := ReadBlock(bc.db, hash)
+	if block == nil || bc.loadBlock(block.Header.ParentHash) == nil {
+		return nil
+	}
+	bc.blocks[hash] = block
+	bc.receipts[hash] = ReadReceipts(bc.db, block)
+	return block
+}
+
+// blockByHash devuelve un bloque de memoria o, si es un bloque lateral que no
+// se ha cargado, de disco. Se llama con bc.mu tomado, aunque sea para leer.
+func (bc *Blockchain) blockByHash(hash common.Hash) *Block {
+	if block, ok := bc.blocks[hash]; ok {
+		return block
+	}
+	return ReadBlock(bc.db, hash)
+}
+
+// writeBlock guarda el bloque, sus recibos y sus cambios de estado.
+func writeBlock(db ethdb.KeyValueWriter, block *Block, receipts Receipts, diff *StateDiff) error {
+	if err := WriteBlock(db, block); err != nil {
+		return fmt.Errorf("write block #%d: %w", block.Header.BlockNumber, err)
+	}
+	if err := WriteReceipts(db, block, receipts); err != nil {
+		return fmt.Errorf("write receipts #%d: %w", block.Header.BlockNumber, err)
+	}
+	if err := WriteStateDiff(db, diff); err != nil {
+		return fmt.Errorf("write state diff #%d: %w", block.Header.BlockNumber, err)
+	}
+	return nil
+}
+
+// stateAt devuelve el estado tras el bloque `hash`, abriéndolo de disco si no
+// está en memoria. Se llama con bc.mu tomado.
+func (bc *Blockchain) stateAt(hash common.Hash) (*State, error) {
+	if state, ok := bc.states[hash]; ok {
+		return state, nil
+	}
+	block := bc.blocks[hash]
+	if block == nil {
+		return nil, fmt.Errorf("%w: unknown block %s", ErrMissingState, hash.Hex())
+	}
+	return bc.openState(block, bc.head)
+}
+
+// openState abre de disco el estado tras `block`. Fuera del modo archivo solo
+// se sirven los estados de los últimos StateHistory bloques antes de `head`.
+// No necesita bc.mu: la base de datos y la caché se pueden usar en paralelo.
+func (bc *Blockchain) openState(block *Block, head *Block) (*State, error) {
+	number := block.Header.BlockNumber
+	if !bc.cacheConfig.Archive && number+bc.cacheConfig.StateHistory < head.Header.BlockNumber {
+		return nil, fmt.Errorf("%w: block #%d is older than the last %d blocks (archive mode is off)",
+			ErrStateNotAvailable, number, bc.cacheConfig.StateHistory)
+	}
+	hash := block.Hash()
+	if state, ok := bc.historical.Get(hash); ok {
+		return state, nil
+	}
+	state, err := OpenState(bc.statedb, block.Header.StateRoot)
+	if err != nil {
+		return nil, fmt.Errorf("state of block #%d: %w", number, err)
+	}
+	bc.historical.Add(hash, state)
+	return state, nil
+}
+
+// evictStates quita de memoria los estados que quedan fuera de la ventana
+// StateHistory; siguen en disco. Se llama con bc.mu tomado.
+func (bc *Blockchain) evictStates() {
+	head := bc.head.Header.BlockNumber
+	for hash := range bc.states {
+		if bc.blocks[hash].Header.BlockNumber+bc.cacheConfig.StateHistory < head {
+			delete(bc.states, hash)
+		}
+	}
+}
+
+// pruneRoots decide, cada GCInterval bloques, si toca podar y devuelve las
+// raíces que se conservan: las de la ventana StateHistory y las de los bloques
+// laterales que siguen en memoria. Se llama con bc.mu tomado y deja la poda
+// empezada, así los estados que se confirmen después de elegir las raíces no
+// se borran aunque el barrido, en segundo plano, coincida con otro InsertBlock.
+// Devuelve nil si no toca podar o si la poda anterior aún no ha terminado: se
+// reintenta en el siguiente bloque.
+func (bc *Blockchain) pruneRoots() []common.Hash {
+	head := bc.head.Header.BlockNumber
+	if bc.stopped || bc.cacheConfig.Archive || bc.cacheConfig.GCInterval == 0 || head < bc.lastGC+bc.cacheConfig.GCInterval {
+		return nil
+	}
+	if !bc.statedb.beginPrune() {
+		return nil
+	}
+	bc.lastGC = head
+
+	var roots []common.Hash
+	for n := head; ; n-- {
+		roots = append(roots, bc.blocks[bc.canonical[n]].Header.StateRoot)
+		if n == 0 || n+bc.cacheConfig.StateHistory <= head {
+			break
+		}
+	}
+	for hash := range bc.states {
+		roots = append(roots, bc.blocks[hash].Header.StateRoot)
+	}
+	return roots
+}
+
+// pruneState borra de disco los nodos de la trie que no se alcanzan desde
+// `roots` (ver pruneRoots). Corre en su propia goroutine y sin bc.mu: el
+// barrido recorre toda la base de datos y no debe parar la cadena mientras tanto.
+//
+// Un fallo al podar no invalida el bloque ya importado: se registra y se
+// reintenta en la siguiente pasada.
+func (bc *Blockchain) pruneState(head uint64, roots []common.Hash) {
+	start := time.Now()
+	stats, err := bc.statedb.prune(roots)
+	if err != nil {
+		log.Printf("State pruning failed at #%d: %v\n", head, err)
+		return
+	}
+	if stats.Deleted > 0 {
+		log.Printf("Pruned state at #%d: %d nodes deleted (%v), %d live, took %v\n",
+			head, stats.Deleted, stats.Freed, stats.Live, time.Since(start))
+	}
+}
+
+// Config devuelve los parámetros de consenso de la cadena.
+func (bc *Blockchain) Config() *ChainConfig {
+	return bc.config
+}
+
+// Genesis devuelve el bloque 0.
+func (bc *Blockchain) Genesis() *Block {
+	return bc.genesis
+}
+
+// CurrentBlock devuelve la cabeza de la cadena canónica.
+func (bc *Blockchain) CurrentBlock() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.head
+}
+
+// State devuelve el estado vivo de la cabeza canónica.
+func (bc *Blockchain) State() *State {
+	return bc.state
+}
+
+// StateAt devuelve una copia del estado tras el bloque `hash`, o nil si no se conoce.
+func (bc *Blockchain) StateAt(hash common.Hash) *State {
+	state, err := bc.ReadStateAt(hash)
+	if err != nil {
+		return nil
+	}
+	return state.Copy()
+}
+
+// ReadStateAt devuelve el estado tras el bloque `hash` sin copiarlo, para
+// consultas: es compartido y no se debe modificar. Los estados antiguos solo
+// están disponibles en modo archivo.
+func (bc *Blockchain) ReadStateAt(hash common.Hash) (*State, error) {
+	bc.mu.RLock()
+	state, ok := bc.states[hash]
+	block, head := bc.blockByHash(hash), bc.head
+	bc.mu.RUnlock()
+	if ok {
+		return state, nil
+	}
+	if block == nil {
+		return nil, fmt.Errorf("%w: unknown block %s", ErrMissingState, hash.Hex())
+	}
+	// Abrir un estado de disco es lento, lo hacemos sin bloquear la cadena
+	state, err := bc.openState(block, head)
+	if errors.Is(err, ErrMissingState) && !bc.cacheConfig.Archive {
+		// Mientras leíamos la cabeza pudo avanzar y una poda borrar este
+		// estado, que ya ha salido de la ventana: no falta, ya no se sirve
+		if current := bc.CurrentBlock(); block.Header.BlockNumber+bc.cacheConfig.StateHistory < current.Header.BlockNumber {
+			return nil, fmt.Errorf("%w: block #%d is older than the last %d blocks (archive mode is off)",
+				ErrStateNotAvailable, block.Header.BlockNumber, bc.cacheConfig.StateHistory)
+		}
+	}
+	return state, err
+}
+
+// GetBlockByHash devuelve cualquier bloque conocido, canónico o no.
+func (bc *Blockchain) GetBlockByHash(hash common.Hash) *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.blockByHash(hash)
+}
+
+// GetHeader devuelve la cabecera de un bloque conocido (implementa ChainContext).
+func (bc *Blockchain) GetHeader(hash common.Hash) *BlockHeader {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if block := bc.blockByHash(hash); block != nil {
+		return block.Header
+	}
+	return nil
+}
+
+// GetBlockByNumber devuelve el bloque canónico de altura `number`.
+func (bc *Blockchain) GetBlockByNumber(number uint64) *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	hash, ok := bc.canonical[number]
+	if !ok {
+		return nil
+	}
+	return bc.blocks[hash]
+}
+
+// GetReceipts devuelve los recibos de un bloque conocido.
+func (bc *Blockchain) GetReceipts(hash common.Hash) Receipts {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if receipts, ok := bc.receipts[hash]; ok {
+		return receipts
+	}
+	if block := ReadBlock(bc.db, hash); block != nil {
+		return ReadReceipts(bc.db, block)
+	}
+	return nil
+}
+
+// GetStateDiff devuelve los cambios de estado que hizo el bloque `hash`, o
+// nil si no se conoce el bloque o se importó antes de guardar los diffs.
+func (bc *Blockchain) GetStateDiff(hash common.Hash) *StateDiff {
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil
+	}
+	return ReadStateDiff(bc.db, hash, block.Header.BlockNumber)
+}
+
+// GetTransaction busca una TX de la cadena canónica por hash usando el índice.
+func (bc *Blockchain) GetTransaction(hash common.Hash) (*RawTx, *Block, uint64) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	entry, ok := bc.txLookup[hash]
+	if !ok {
+		return nil, nil, 0
+	}
+	block := bc.blocks[entry.BlockHash]
+	return block.Transactions[entry.Index], block, entry.Index
+}
+
+// GetReceipt devuelve el recibo de una TX de la cadena canónica.
+func (bc *Blockchain) GetReceipt(hash common.Hash) *Receipt {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	entry, ok := bc.txLookup[hash]
+	if !ok {
+		return nil
+	}
+	return bc.receipts[entry.BlockHash][entry.Index]
+}
+
+// SubscribeChainHeadEvent registra un canal que recibe cada nueva cabeza.
+func (bc *Blockchain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) event.Subscription {
+	return bc.headFeed.Subscribe(ch)
+}
+
+// InsertBlock valida el bloque contra el estado de su padre y lo guarda.
+// Si el bloque gana el fork choice pasa a ser la nueva cabeza, haciendo un
+// reorg si no extiende la cabeza actual.
+func (bc *Blockchain) InsertBlock(block *Block) error {
+	bc.mu.Lock()
+	hash := block.Hash()
+	if bc.blockByHash(hash) != nil {
+		bc.mu.Unlock()
+		return ErrKnownBlock
+	}
+	parent := bc.loadBlock(block.Header.ParentHash)
+	if parent == nil {
+		bc.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownParent, block.Header.ParentHash.Hex())
+	}
+	parentState, err := bc.stateAt(parent.Hash())
+	if err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+	post, receipts, err := ValidateBlock(bc.config, blockIndex(bc.blocks), parent, block, parentState)
+	if err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+	receipts.DeriveFields(block)
+	diff := &StateDiff{
+		BlockHash:   hash,
+		BlockNumber: block.Header.BlockNumber,
+		Accounts:    diffStates(parentState, post),
+	}
+
+	// Guardamos el bloque antes de tocar la cadena en memoria: si falla el
+	// disco el bloque simplemente no se importa. Los nodos del estado van
+	// aparte: se guardan por su hash y, si el resto no llega a escribirse,
+	// solo quedan huérfanos hasta la siguiente poda
+	if _, err := post.Commit(); err != nil {
+		bc.mu.Unlock()
+		return fmt.Errorf("commit state of block #%d: %w", block.Header.BlockNumber, err)
+	}
+
+	// Fork choice: solo cambiamos de cabeza si la nueva cadena es más larga
+	var branch []*Block
+	if block.Header.BlockNumber > bc.head.Header.BlockNumber {
+		branch = bc.newCanonicalBranch(block)
+	}
+	// El bloque, sus recibos y su diff y, si pasa a ser la cabeza, los índices
+	// canónicos y el puntero a la cabeza se escriben en un único batch: si el
+	// nodo se cae a mitad de un reorg la base de datos queda como antes o como
+	// después, nunca con la cabeza de una rama y los índices de otra
+	batch := bc.db.NewBatch()
+	if err := writeBlock(batch, block, receipts, diff); err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+	if err := writeCanonical(batch, branch); err != nil {
+		bc.mu.Unlock()
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		bc.mu.Unlock()
+		return fmt.Errorf("write block #%d: %w", block.Header.BlockNumber, err)
+	}
+	bc.blocks[hash] = block
+	bc.states[hash] = post
+	bc.receipts[hash] = receipts
+
+	if branch == nil {
+		bc.mu.Unlock()
+		log.Printf("Side block imported #%d %s\n", block.Header.BlockNumber, hash.Hex())
+		return nil
+	}
+	var dropped []*RawTx
+	if block.Header.ParentHash != bc.head.Hash() {
+		dropped = bc.reorg(branch)
+	} else {
+		bc.setCanonical(block)
+	}
+	bc.state.Reset(post)
+	bc.head = block
+	bc.evictStates()
+	// El barrido recorre toda la base de datos: va en segundo plano para no
+	// retrasar a quien importa el bloque
+	if roots := bc.pruneRoots(); roots != nil {
+		bc.pruneWG.Add(1)
+		go func() {
+			defer bc.pruneWG.Done()
+			bc.pruneState(block.Header.BlockNumber, roots)
+		}()
+	}
+	bc.mu.Unlock()
+
+	bc.headFeed.Send(ChainHeadEvent{Block: block, Dropped: dropped})
+	return nil
+}
+
+// Stop espera a que termine la poda en marcha, si la hay, y no deja empezar
+// otra: hay que llamarlo antes de cerrar la base de datos.
+func (bc *Blockchain) Stop() {
+	bc.mu.Lock()
+	bc.stopped = true
+	bc.mu.Unlock()
+	bc.pruneWG.Wait()
+}
+
+// newCanonicalBranch devuelve los bloques que pasan a ser canónicos si `head`
+// se convierte en la cabeza: de `head` hacia atrás hasta el ancestro común con
+// la cadena actual, sin incluirlo. Se llama con bc.mu tomado.
+func (bc *Blockchain) newCanonicalBranch(head *Block) []*Block {
+	var branch []*Block
+	for block := head; bc.canonical[block.Header.BlockNumber] != block.Hash(); block = bc.blocks[block.Header.ParentHash] {
+		branch = append(branch, block)
+	}
+	return branch
+}
+
+// reorg cambia en memoria la cadena canónica por la que termina en
+// `branch[0]` (ver newCanonicalBranch), ya escrita en disco. Devuelve las TXs
+// de la rama abandonada que la nueva no incluye, para devolverlas al pool.
+// Cada bloque de la rama se validó al importarlo, no hace falta re-ejecutar
+// nada: el estado de la nueva cabeza ya está calculado. Se llama con bc.mu tomado.
+func (bc *Blockchain) reorg(branch []*Block) []*RawTx {
+	ancestor := branch[len(branch)-1].Header.BlockNumber - 1
+
+	// Reescribimos el índice canónico y el de transacciones, apartando las
+	// TXs de la rama vieja que no están en la nueva
+	included := make(map[common.Hash]struct{})
+	for _, block := range branch {
+		for _, tx := range block.Transactions {
+			included[tx.Hash()] = struct{}{}
+		}
+	}
+	var dropped []*RawTx
+	oldHead := bc.head.Header.BlockNumber
+	for n := ancestor + 1; n <= oldHead; n++ {
+		for _, tx := range bc.blocks[bc.canonical[n]].Transactions {
+			delete(bc.txLookup, tx.Hash())
+			if _, ok := included[tx.Hash()]; !ok {
+				dropped = append(dropped, tx)
+			}
+		}
+		delete(bc.canonical, n)
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		bc.setCanonical(branch[i])
+	}
+
+	log.Printf("Chain reorg: common ancestor #%d, dropped %d blocks, added %d blocks, %d txs back to the pool\n",
+		ancestor, oldHead-ancestor, len(branch), len(dropped))
+	return dropped
+}
+
+// setCanonical marca el bloque como canónico en su altura e indexa sus transacciones.
+// Se llama con bc.mu tomado.
+func (bc *Blockchain) setCanonical(block *Block) {
+	hash := block.Hash()
+	bc.canonical[block.Header.BlockNumber] = hash
+	for i, tx := range block.Transactions {
+		bc.txLookup[tx.Hash()] = TxLookupEntry{BlockHash: hash, Index: uint64(i)}
+	}
+}
+
+// writeCanonical escribe en `db` los bloques de `branch` (ver
+// newCanonicalBranch) como canónicos en su altura y el primero como cabeza.
+// No hace falta borrar las alturas de la rama vieja: la nueva es más larga y
+// las cubre todas. Con `branch` vacío no escribe nada.
+func writeCanonical(db ethdb.KeyValueWriter, branch []*Block) error {
+	for _, block := range branch {
+		if err := WriteCanonicalHash(db, block.Hash(), block.Header.BlockNumber); err != nil {
+			return fmt.Errorf("write canonical hash #%d: %w", block.Header.BlockNumber, err)
+		}
+	}
+	if len(branch) == 0 {
+		return nil
+	}
+	return WriteHeadBlockHash(db, branch[0].Hash())
+}
@@ -0,0 +1,380 @@
+// core/blockchain_test.go
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// newTestTx firma una TX EIP-1559 para la cadena por defecto.
+func newTestTx(t testing.TB, key *ecdsa.PrivateKey, nonce uint64, to *common.Address, data []byte) *RawTx {
+	t.Helper()
+	chainID := DefaultChainConfig().ChainID
+	signed, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1e10),
+		Gas:       100000,
+		To:        to,
+		Value:     big.NewInt(1),
+		Data:      data,
+	}), types.NewLondonSigner(chainID), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return toRawTx(t, signed)
+}
+
+// newTestChain crea una cadena en `db` con una cuenta con fondos.
+func newTestChain(t *testing.T, db storage.KeyValueStore) (*Blockchain, *Genesis, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, _ := crypto.GenerateKey()
+	genesis := &Genesis{
+		Config:   DefaultChainConfig(),
+		GasLimit: DefaultGasLimit,
+		Alloc:    GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(1e18)}},
+	}
+	bc, err := NewBlockchain(db, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc, genesis, key
+}
+
+// buildBlock sella un hijo de `parent` con `txs`, como ProduceBlock pero
+// sobre cualquier bloque, para construir ramas.
+func buildBlock(t testing.TB, bc *Blockchain, parent *Block, coinbase common.Address, txs ...*RawTx) *Block {
+	t.Helper()
+	state := bc.StateAt(parent.Hash())
+	header := NewHeader(parent, coinbase, parent.Header.GasLimit)
+	receipts := make([]*Receipt, len(txs))
+	var usedGas uint64
+	for i, tx := range txs {
+		from, err := tx.VerifySignature(bc.Config().ChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipts[i], err = ApplyTransaction(bc.Config(), bc, state, header, from, tx, &usedGas); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := state.UpdateMerkle(); err != nil {
+		t.Fatal(err)
+	}
+	header.StateRoot = state.Root()
+	header.GasUsed = usedGas
+	return NewBlock(header, txs, receipts)
+}
+
+func insertBlocks(t *testing.T, bc *Blockchain, blocks ...*Block) {
+	t.Helper()
+	for _, block := range blocks {
+		if err := bc.InsertBlock(block); err != nil {
+			t.Fatalf("insert block #%d: %v", block.Header.BlockNumber, err)
+		}
+	}
+}
+
+func TestReorg(t *testing.T) {
+	bc, _, key := newTestChain(t, storage.NewMemoryDB())
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	pool := NewTxPool(bc, TxPoolConfig{})
+	defer pool.Stop()
+	heads := make(chan ChainHeadEvent, 10)
+	sub := bc.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	to := common.HexToAddress("0x1234")
+	tx0, tx1 := newTestTx(t, key, 0, &to, nil), newTestTx(t, key, 1, &to, nil)
+	canonical, side := common.HexToAddress("0xc1"), common.HexToAddress("0xc2")
+
+	// Rama A: génesis <- a1(tx0) <- a2(tx1)
+	a1 := buildBlock(t, bc, bc.Genesis(), canonical, tx0)
+	insertBlocks(t, bc, a1)
+	a2 := buildBlock(t, bc, a1, canonical, tx1)
+	insertBlocks(t, bc, a2)
+	for _, want := range []*Block{a1, a2} {
+		if ev := <-heads; ev.Block.Hash() != want.Hash() || len(ev.Dropped) != 0 {
+			t.Fatalf("head event: have #%d, want #%d", ev.Block.Header.BlockNumber, want.Header.BlockNumber)
+		}
+	}
+
+	// Rama B con la misma altura: empate, se queda la cabeza que ya teníamos
+	b1 := buildBlock(t, bc, bc.Genesis(), side, tx0)
+	insertBlocks(t, bc, b1)
+	b2 := buildBlock(t, bc, b1, side)
+	insertBlocks(t, bc, b2)
+	if head := bc.CurrentBlock(); head.Hash() != a2.Hash() {
+		t.Fatalf("tie changed the head to #%d %s", head.Header.BlockNumber, head.Hash().Hex())
+	}
+	if _, block, _ := bc.GetTransaction(tx1.Hash()); block == nil || block.Hash() != a2.Hash() {
+		t.Fatal("tx1 not indexed in the canonical chain")
+	}
+
+	// B pasa a ser más larga: reorg
+	b3 := buildBlock(t, bc, b2, side)
+	insertBlocks(t, bc, b3)
+	if head := bc.CurrentBlock(); head.Hash() != b3.Hash() {
+		t.Fatalf("longer chain not adopted, head #%d", head.Header.BlockNumber)
+	}
+	for n, want := range []*Block{bc.Genesis(), b1, b2, b3} {
+		if got := bc.GetBlockByNumber(uint64(n)); got.Hash() != want.Hash() {
+			t.Fatalf("canonical #%d: have %s, want %s", n, got.Hash().Hex(), want.Hash().Hex())
+		}
+	}
+	if _, block, index := bc.GetTransaction(tx0.Hash()); block == nil || block.Hash() != b1.Hash() || index != 0 {
+		t.Fatal("tx0 not re-indexed to the new branch")
+	}
+	if tx, _, _ := bc.GetTransaction(tx1.Hash()); tx != nil {
+		t.Fatal("tx1 still indexed after leaving the canonical chain")
+	}
+	if got := bc.State().GetNonce(sender); got != 1 {
+		t.Fatalf("nonce after reorg: have %d, want 1", got)
+	}
+
+	select {
+	case ev := <-heads:
+		if ev.Block.Hash() != b3.Hash() || len(ev.Dropped) != 1 || ev.Dropped[0].Hash() != tx1.Hash() {
+			t.Fatalf("reorg event: head #%d, dropped %d txs", ev.Block.Header.BlockNumber, len(ev.Dropped))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no head event for the reorg")
+	}
+	// La TX de la rama abandonada vuelve al pool
+	deadline := time.Now().Add(time.Second)
+	for pool.Get(tx1.Hash()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("dropped tx not re-injected into the pool")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestReorgReopen hace un reorg y vuelve a abrir la cadena desde la base de
+// datos: la cabeza, los índices canónicos, los recibos y el estado deben ser
+// los de la nueva rama.
+func TestReorgReopen(t *testing.T) {
+	db := storage.NewMemoryDB()
+	bc, genesis, key := newTestChain(t, db)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to, other := common.HexToAddress("0x1234"), common.HexToAddress("0x5678")
+	tx0, tx1, txB := newTestTx(t, key, 0, &to, nil), newTestTx(t, key, 1, &to, nil), newTestTx(t, key, 1, &other, nil)
+	canonical, side := common.HexToAddress("0xc1"), common.HexToAddress("0xc2")
+
+	a1 := buildBlock(t, bc, bc.Genesis(), canonical, tx0)
+	insertBlocks(t, bc, a1)
+	a2 := buildBlock(t, bc, a1, canonical, tx1)
+	insertBlocks(t, bc, a2)
+	b1 := buildBlock(t, bc, bc.Genesis(), side, tx0)
+	insertBlocks(t, bc, b1)
+	b2 := buildBlock(t, bc, b1, side, txB)
+	insertBlocks(t, bc, b2)
+	b3 := buildBlock(t, bc, b2, side)
+	insertBlocks(t, bc, b3)
+	if head := bc.CurrentBlock(); head.Hash() != b3.Hash() {
+		t.Fatalf("reorg not applied, head #%d", head.Header.BlockNumber)
+	}
+
+	bc, err := NewBlockchain(db, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != b3.Hash() || ReadHeadBlockHash(db) != b3.Hash() {
+		t.Fatalf("reopened head #%d %s, want b3", head.Header.BlockNumber, head.Hash().Hex())
+	}
+	for n, want := range []*Block{bc.Genesis(), b1, b2, b3} {
+		if got := bc.GetBlockByNumber(uint64(n)); got == nil || got.Hash() != want.Hash() {
+			t.Fatalf("reopened canonical #%d does not match the new branch", n)
+		}
+	}
+	for _, check := range []struct {
+		tx    *RawTx
+		block *Block
+	}{{tx0, b1}, {txB, b2}} {
+		if _, block, index := bc.GetTransaction(check.tx.Hash()); block == nil || block.Hash() != check.block.Hash() || index != 0 {
+			t.Fatalf("tx %s not indexed in block #%d", check.tx.Hash().Hex(), check.block.Header.BlockNumber)
+		}
+		receipt := bc.GetReceipt(check.tx.Hash())
+		if receipt == nil || receipt.BlockHash != check.block.Hash() || receipt.TxHash != check.tx.Hash() || receipt.Status != ReceiptStatusSuccessful {
+			t.Fatalf("receipt of tx %s: %+v", check.tx.Hash().Hex(), receipt)
+		}
+	}
+	if tx, _, _ := bc.GetTransaction(tx1.Hash()); tx != nil || bc.GetReceipt(tx1.Hash()) != nil {
+		t.Fatal("tx1 of the abandoned branch still indexed after reopening")
+	}
+	if root := bc.State().Root(); root != b3.Header.StateRoot {
+		t.Fatalf("reopened state root %x, want %x", root, b3.Header.StateRoot)
+	}
+	if nonce := bc.State().GetNonce(sender); nonce != 2 {
+		t.Fatalf("reopened nonce %d, want 2", nonce)
+	}
+}
+
+// TestSideChainReopen guarda una rama lateral, vuelve a abrir la cadena y le
+// añade un hijo: los bloques laterales se leen de disco y el reorg se hace igual.
+func TestSideChainReopen(t *testing.T) {
+	db := storage.NewMemoryDB()
+	bc, genesis, key := newTestChain(t, db)
+	to, other := common.HexToAddress("0x1234"), common.HexToAddress("0x5678")
+	tx0, tx1, txB := newTestTx(t, key, 0, &to, nil), newTestTx(t, key, 1, &to, nil), newTestTx(t, key, 1, &other, nil)
+	canonical, side := common.HexToAddress("0xc1"), common.HexToAddress("0xc2")
+
+	a1 := buildBlock(t, bc, bc.Genesis(), canonical, tx0)
+	insertBlocks(t, bc, a1)
+	a2 := buildBlock(t, bc, a1, canonical, tx1)
+	insertBlocks(t, bc, a2)
+	b1 := buildBlock(t, bc, bc.Genesis(), side, tx0)
+	insertBlocks(t, bc, b1)
+	b2 := buildBlock(t, bc, b1, side, txB)
+	insertBlocks(t, bc, b2)
+	b3 := buildBlock(t, bc, b2, side)
+	if head := bc.CurrentBlock(); head.Hash() != a2.Hash() {
+		t.Fatalf("side branch became canonical, head #%d", head.Header.BlockNumber)
+	}
+
+	bc, err := NewBlockchain(db, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block := bc.GetBlockByHash(b2.Hash()); block == nil || len(bc.GetReceipts(b2.Hash())) != 1 {
+		t.Fatal("side block not readable after reopening")
+	}
+	if err := bc.InsertBlock(b2); !errors.Is(err, ErrKnownBlock) {
+		t.Fatalf("reinserting a stored side block: have %v, want %v", err, ErrKnownBlock)
+	}
+	insertBlocks(t, bc, b3)
+	if head := bc.CurrentBlock(); head.Hash() != b3.Hash() {
+		t.Fatalf("child of a stored side branch did not reorg, head #%d", head.Header.BlockNumber)
+	}
+	for n, want := range []*Block{bc.Genesis(), b1, b2, b3} {
+		if got := bc.GetBlockByNumber(uint64(n)); got == nil || got.Hash() != want.Hash() {
+			t.Fatalf("canonical #%d does not match the side branch", n)
+		}
+	}
+	if _, block, _ := bc.GetTransaction(txB.Hash()); block == nil || block.Hash() != b2.Hash() {
+		t.Fatal("tx of the loaded side branch not indexed")
+	}
+	if tx, _, _ := bc.GetTransaction(tx1.Hash()); tx != nil {
+		t.Fatal("tx1 of the abandoned branch still indexed")
+	}
+}
+
+// revertInitCode despliega un contrato que escribe el slot 0, emite un log y
+// termina siempre con REVERT.
+var revertInitCode = common.FromHex("600f600c600039600f6000f3" + "6001600055" + "60006000a0" + "60006000fd")
+
+// TestRevertedTx comprueba que una TX que revierte entra en el bloque con
+// status 0: cobra el gas y sube el nonce, pero deshace sus cambios de estado.
+func TestRevertedTx(t *testing.T) {
+	bc, _, key := newTestChain(t, storage.NewMemoryDB())
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	contract := crypto.CreateAddress(sender, 0)
+	deploy := buildBlock(t, bc, bc.Genesis(), common.Address{}, newTestTx(t, key, 0, nil, revertInitCode))
+	insertBlocks(t, bc, deploy)
+	if code := bc.State().GetCode(contract); len(code) != 15 {
+		t.Fatalf("contract not deployed: code %x", code)
+	}
+
+	balance, contractBalance := bc.State().GetBalance(sender), bc.State().GetBalance(contract)
+	tx := newTestTx(t, key, 1, &contract, nil) // también transfiere 1 wei
+	block := buildBlock(t, bc, deploy, common.Address{}, tx)
+	insertBlocks(t, bc, block)
+
+	if len(block.Transactions) != 1 {
+		t.Fatalf("reverted tx not included: %d txs", len(block.Transactions))
+	}
+	receipt := bc.GetReceipts(block.Hash())[0]
+	if receipt.Status != types.ReceiptStatusFailed || len(receipt.Logs) != 0 {
+		t.Fatalf("receipt: status %d, %d logs", receipt.Status, len(receipt.Logs))
+	}
+	if receipt.GasUsed <= params.TxGas || receipt.GasUsed != block.Header.GasUsed {
+		t.Fatalf("gas used %d, block %d", receipt.GasUsed, block.Header.GasUsed)
+	}
+	state := bc.State()
+	if nonce := state.GetNonce(sender); nonce != 2 {
+		t.Fatalf("sender nonce %d, want 2", nonce)
+	}
+	// Solo paga el gas: el value vuelve al revertir
+	fee := new(uint256.Int).Mul(uint256.NewInt(receipt.GasUsed), uint256.MustFromBig(receipt.EffectiveGasPrice))
+	if have := new(uint256.Int).Sub(balance, state.GetBalance(sender)); !have.Eq(fee) {
+		t.Fatalf("sender paid %v, want the gas %v", have, fee)
+	}
+	if slot := state.GetState(contract, common.Hash{}); slot != (common.Hash{}) {
+		t.Fatalf("reverted store kept: slot 0 = %x", slot)
+	}
+	if have := state.GetBalance(contract); !have.Eq(contractBalance) {
+		t.Fatalf("reverted transfer kept: contract balance %v, want %v", have, contractBalance)
+	}
+}
+
+// TestProduceBlockMissingState comprueba que el productor devuelve un error,
+// y no entra en pánico, si el estado de la cabeza no está ni en memoria ni en disco.
+func TestProduceBlockMissingState(t *testing.T) {
+	db := storage.NewMemoryDB()
+	bc, _, key := newTestChain(t, db)
+	pool := NewTxPool(bc, TxPoolConfig{})
+	defer pool.Stop()
+	to := common.HexToAddress("0x1234")
+	addTx(t, pool, key, 0, &to, nil)
+
+	head := bc.CurrentBlock()
+	bc.mu.Lock()
+	delete(bc.states, head.Hash())
+	bc.mu.Unlock()
+	if err := db.Delete(head.Header.StateRoot.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	block, err := NewBlockProducer(bc, pool, DefaultProducerConfig).ProduceBlock()
+	if !errors.Is(err, ErrMissingState) || block != nil {
+		t.Fatalf("produce on a missing state: block %v, err %v, want %v", block, err, ErrMissingState)
+	}
+}
+
+// BenchmarkInsertBlock mide InsertBlock (validar sobre una copia del estado
+// del padre, guardar y adoptar la nueva cabeza) con bloques de 10
+// transferencias: el coste no debe crecer con el número de cuentas. En modo
+// archivo, porque la poda periódica recorre todo el estado a propósito.
+func BenchmarkInsertBlock(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("accounts=%d", size), func(b *testing.B) {
+			key, _ := crypto.GenerateKey()
+			alloc := GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(1e18)}}
+			for i := 0; i < size; i++ {
+				alloc[benchAddress(i)] = GenesisAccount{Balance: big.NewInt(1)}
+			}
+			bc, err := NewBlockchain(storage.NewMemoryDB(), &Genesis{Config: DefaultChainConfig(), GasLimit: DefaultGasLimit, Alloc: alloc}, &CacheConfig{Archive: true})
+			if err != nil {
+				b.Fatal(err)
+			}
+			coinbase := common.HexToAddress("0xc0")
+			var nonce uint64
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				txs := make([]*RawTx, 10)
+				for j := range txs {
+					to := benchAddress((i*len(txs) + j) % size)
+					txs[j] = newTestTx(b, key, nonce, &to, nil)
+					nonce++
+				}
+				block := buildBlock(b, bc, bc.CurrentBlock(), coinbase, txs...)
+				b.StartTimer()
+				if err := bc.InsertBlock(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
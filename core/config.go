@@ -0,0 +1,50 @@
+// core/config.go
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DefaultChainID es el chain ID de la red de desarrollo.
+const DefaultChainID = 1337
+
+// ChainConfig son los parámetros de consenso de la cadena.
+type ChainConfig struct {
+	// ChainID entra en el hash de firma (EIP-155) para evitar replays entre cadenas
+	ChainID *big.Int
+}
+
+// DefaultChainConfig devuelve la configuración de la red de desarrollo.
+func DefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		ChainID: big.NewInt(DefaultChainID),
+	}
+}
+
+// EVMConfig traduce la configuración a la de go-ethereum para la EVM.
+// La cadena arranca con todos los forks activos hasta Cancun desde el génesis.
+func (c *ChainConfig) EVMConfig() *params.ChainConfig {
+	zero := uint64(0)
+	return &params.ChainConfig{
+		ChainID:                 c.ChainID,
+		HomesteadBlock:          big.NewInt(0),
+		EIP150Block:             big.NewInt(0),
+		EIP155Block:             big.NewInt(0),
+		EIP158Block:             big.NewInt(0),
+		ByzantiumBlock:          big.NewInt(0),
+		ConstantinopleBlock:     big.NewInt(0),
+		PetersburgBlock:         big.NewInt(0),
+		IstanbulBlock:           big.NewInt(0),
+		MuirGlacierBlock:        big.NewInt(0),
+		BerlinBlock:             big.NewInt(0),
+		LondonBlock:             big.NewInt(0),
+		ArrowGlacierBlock:       big.NewInt(0),
+		GrayGlacierBlock:        big.NewInt(0),
+		MergeNetsplitBlock:      big.NewInt(0),
+		TerminalTotalDifficulty: big.NewInt(0),
+		ShanghaiTime:            &zero,
+		CancunTime:              &zero,
+	}
+}
@@ -0,0 +1,245 @@
+// core/database.go
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Esquema de claves de la base de datos, el mismo que usa geth para que sea
+// fácil de inspeccionar. Los nodos de las tries se guardan aparte, con su hash
+// (32 bytes) como clave, y el código y los preimages con las claves de rawdb.
+//
+//	"h" + número + hash -> cabecera (RLP)
+//	"b" + número + hash -> transacciones del bloque (RLP)
+//	"r" + número + hash -> recibos del bloque (RLP)
+//	"d" + número + hash -> StateDiff del bloque (RLP)
+//	"H" + hash          -> número del bloque
+//	"h" + número + "n"  -> hash canónico de esa altura
+//	"LastBlock"         -> hash de la cabeza canónica
+var (
+	headBlockKey = []byte("LastBlock")
+
+	headerPrefix       = []byte("h")
+	headerHashSuffix   = []byte("n")
+	headerNumberPrefix = []byte("H")
+	blockBodyPrefix    = []byte("b")
+	blockReceiptPrefix = []byte("r")
+	stateDiffPrefix    = []byte("d")
+)
+
+func encodeBlockNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+func numHashKey(prefix []byte, number uint64, hash common.Hash) []byte {
+	return append(append(append([]byte{}, prefix...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+func headerKey(number uint64, hash common.Hash) []byte {
+	return numHashKey(headerPrefix, number, hash)
+}
+
+func bodyKey(number uint64, hash common.Hash) []byte {
+	return numHashKey(blockBodyPrefix, number, hash)
+}
+
+func receiptsKey(number uint64, hash common.Hash) []byte {
+	return numHashKey(blockReceiptPrefix, number, hash)
+}
+
+func stateDiffKey(number uint64, hash common.Hash) []byte {
+	return numHashKey(stateDiffPrefix, number, hash)
+}
+
+func headerNumberKey(hash common.Hash) []byte {
+	return append(append([]byte{}, headerNumberPrefix...), hash.Bytes()...)
+}
+
+func canonicalHashKey(number uint64) []byte {
+	return append(append(append([]byte{}, headerPrefix...), encodeBlockNumber(number)...), headerHashSuffix...)
+}
+
+// Las funciones Write* reciben un ethdb.KeyValueWriter, como las de rawdb en
+// geth: la base de datos o un batch, para escribir varias cosas a la vez.
+
+// WriteBlock guarda la cabecera, las transacciones y el índice hash -> número.
+func WriteBlock(db ethdb.KeyValueWriter, block *Block) error {
+	hash, number := block.Hash(), block.Header.BlockNumber
+	header, err := rlp.EncodeToBytes(block.Header)
+	if err != nil {
+		return fmt.Errorf("encode header #%d: %w", number, err)
+	}
+	body, err := rlp.EncodeToBytes(block.Transactions)
+	if err != nil {
+		return fmt.Errorf("encode body #%d: %w", number, err)
+	}
+	if err := db.Put(headerKey(number, hash), header); err != nil {
+		return err
+	}
+	if err := db.Put(bodyKey(number, hash), body); err != nil {
+		return err
+	}
+	return db.Put(headerNumberKey(hash), encodeBlockNumber(number))
+}
+
+// ReadBlockNumber devuelve la altura de un bloque guardado.
+func ReadBlockNumber(db storage.KeyValueStore, hash common.Hash) (uint64, bool) {
+	enc, err := db.Get(headerNumberKey(hash))
+	if err != nil || len(enc) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(enc), true
+}
+
+// ReadBlock reconstruye un bloque guardado, o nil si no está.
+func ReadBlock(db storage.KeyValueStore, hash common.Hash) *Block {
+	number, ok := ReadBlockNumber(db, hash)
+	if !ok {
+		return nil
+	}
+	enc, err := db.Get(headerKey(number, hash))
+	if err != nil {
+		return nil
+	}
+	header := new(BlockHeader)
+	if err := rlp.DecodeBytes(enc, header); err != nil {
+		return nil
+	}
+	enc, err = db.Get(bodyKey(number, hash))
+	if err != nil {
+		return nil
+	}
+	var txs []*RawTx
+	if err := rlp.DecodeBytes(enc, &txs); err != nil {
+		return nil
+	}
+	return &Block{Header: header, Transactions: txs}
+}
+
+// storedReceipt es la forma en que se guarda un recibo: los campos de consenso
+// más los que se conocen al ejecutar. El bloom y los campos de bloque se
+// recalculan al leerlo.
+type storedReceipt struct {
+	Type              uint8
+	Status            uint64
+	CumulativeGasUsed uint64
+	Logs              []*types.Log
+	TxHash            common.Hash
+	From              common.Address
+	ContractAddress   common.Address
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+}
+
+// WriteReceipts guarda los recibos de un bloque.
+func WriteReceipts(db ethdb.KeyValueWriter, block *Block, receipts Receipts) error {
+	stored := make([]*storedReceipt, len(receipts))
+	for i, r := range receipts {
+		stored[i] = &storedReceipt{
+			Type:              r.Type,
+			Status:            r.Status,
+			CumulativeGasUsed: r.CumulativeGasUsed,
+			Logs:              r.Logs,
+			TxHash:            r.TxHash,
+			From:              r.From,
+			ContractAddress:   r.ContractAddress,
+			GasUsed:           r.GasUsed,
+			EffectiveGasPrice: bigOrZero(r.EffectiveGasPrice),
+		}
+	}
+	enc, err := rlp.EncodeToBytes(stored)
+	if err != nil {
+		return fmt.Errorf("encode receipts #%d: %w", block.Header.BlockNumber, err)
+	}
+	return db.Put(receiptsKey(block.Header.BlockNumber, block.Hash()), enc)
+}
+
+// ReadReceipts devuelve los recibos guardados de un bloque con todos sus
+// campos derivados, o nil si no están.
+func ReadReceipts(db storage.KeyValueStore, block *Block) Receipts {
+	enc, err := db.Get(receiptsKey(block.Header.BlockNumber, block.Hash()))
+	if err != nil {
+		return nil
+	}
+	var stored []*storedReceipt
+	if err := rlp.DecodeBytes(enc, &stored); err != nil {
+		return nil
+	}
+	receipts := make(Receipts, len(stored))
+	for i, s := range stored {
+		receipts[i] = &Receipt{
+			Type:              s.Type,
+			Status:            s.Status,
+			CumulativeGasUsed: s.CumulativeGasUsed,
+			Bloom:             types.BytesToBloom(types.LogsBloom(s.Logs)),
+			Logs:              s.Logs,
+			TxHash:            s.TxHash,
+			From:              s.From,
+			ContractAddress:   s.ContractAddress,
+			GasUsed:           s.GasUsed,
+			EffectiveGasPrice: s.EffectiveGasPrice,
+		}
+	}
+	receipts.DeriveFields(block)
+	return receipts
+}
+
+// WriteStateDiff guarda los cambios de estado de un bloque.
+func WriteStateDiff(db ethdb.KeyValueWriter, diff *StateDiff) error {
+	enc, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return fmt.Errorf("encode state diff #%d: %w", diff.BlockNumber, err)
+	}
+	return db.Put(stateDiffKey(diff.BlockNumber, diff.BlockHash), enc)
+}
+
+// ReadStateDiff devuelve los cambios de estado guardados de un bloque, o nil si no están.
+func ReadStateDiff(db storage.KeyValueStore, hash common.Hash, number uint64) *StateDiff {
+	enc, err := db.Get(stateDiffKey(number, hash))
+	if err != nil {
+		return nil
+	}
+	diff := new(StateDiff)
+	if err := rlp.DecodeBytes(enc, diff); err != nil {
+		return nil
+	}
+	return diff
+}
+
+// WriteCanonicalHash marca `hash` como el bloque canónico de la altura `number`.
+func WriteCanonicalHash(db ethdb.KeyValueWriter, hash common.Hash, number uint64) error {
+	return db.Put(canonicalHashKey(number), hash.Bytes())
+}
+
+// ReadCanonicalHash devuelve el hash canónico de una altura (cero si no hay).
+func ReadCanonicalHash(db storage.KeyValueStore, number uint64) common.Hash {
+	enc, err := db.Get(canonicalHashKey(number))
+	if err != nil {
+		return common.Hash{}
+	}
+	return common.BytesToHash(enc)
+}
+
+// WriteHeadBlockHash guarda el puntero a la cabeza canónica.
+func WriteHeadBlockHash(db ethdb.KeyValueWriter, hash common.Hash) error {
+	return db.Put(headBlockKey, hash.Bytes())
+}
+
+// ReadHeadBlockHash devuelve la cabeza canónica guardada (cero si la base de datos está vacía).
+func ReadHeadBlockHash(db storage.KeyValueStore) common.Hash {
+	enc, err := db.Get(headBlockKey)
+	if err != nil {
+		return common.Hash{}
+	}
+	return common.BytesToHash(enc)
+}
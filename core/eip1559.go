@@ -0,0 +1,49 @@
+// core/eip1559.go
+package core
+
+import (
+	"math/big"
+)
+
+// Parámetros del mercado de fees de EIP-1559
+const (
+	InitialBaseFee           = 1_000_000_000 // base fee del génesis (1 gwei)
+	ElasticityMultiplier     = 2             // gas límite / gas objetivo
+	BaseFeeChangeDenominator = 8             // cambio máximo de 1/8 por bloque
+)
+
+// CalcBaseFee calcula la base fee de un hijo de `parent`: sube si el padre
+// consumió más gas que el objetivo (la mitad del gas límite) y baja si consumió menos.
+func CalcBaseFee(parent *BlockHeader) *big.Int {
+	parentBaseFee := bigOrZero(parent.BaseFee)
+	parentGasTarget := parent.GasLimit / ElasticityMultiplier
+	if parentGasTarget == 0 || parent.GasUsed == parentGasTarget {
+		return new(big.Int).Set(parentBaseFee)
+	}
+
+	var (
+		num   = new(big.Int)
+		denom = new(big.Int)
+	)
+	if parent.GasUsed > parentGasTarget {
+		// baseFee + max(1, baseFee * gasUsedDelta / gasTarget / 8)
+		num.SetUint64(parent.GasUsed - parentGasTarget)
+		num.Mul(num, parentBaseFee)
+		num.Div(num, denom.SetUint64(parentGasTarget))
+		num.Div(num, denom.SetUint64(BaseFeeChangeDenominator))
+		if num.Cmp(big.NewInt(1)) < 0 {
+			num.SetInt64(1)
+		}
+		return num.Add(num, parentBaseFee)
+	}
+	// max(0, baseFee - baseFee * gasUsedDelta / gasTarget / 8)
+	num.SetUint64(parentGasTarget - parent.GasUsed)
+	num.Mul(num, parentBaseFee)
+	num.Div(num, denom.SetUint64(parentGasTarget))
+	num.Div(num, denom.SetUint64(BaseFeeChangeDenominator))
+	baseFee := num.Sub(parentBaseFee, num)
+	if baseFee.Sign() < 0 {
+		baseFee.SetInt64(0)
+	}
+	return baseFee
+}
@@ -0,0 +1,106 @@
+// core/eip1559_test.go
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip1559"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// TestCalcBaseFee compara CalcBaseFee con la implementación de go-ethereum.
+func TestCalcBaseFee(t *testing.T) {
+	config := DefaultChainConfig().EVMConfig()
+	tests := []struct {
+		name     string
+		gasLimit uint64
+		gasUsed  uint64
+		baseFee  int64
+		want     int64
+	}{
+		{"at target", 20_000_000, 10_000_000, InitialBaseFee, InitialBaseFee},
+		{"full block", 20_000_000, 20_000_000, InitialBaseFee, InitialBaseFee * 9 / 8},
+		{"above target", 20_000_000, 11_000_000, InitialBaseFee, 1_012_500_000},
+		{"empty block", 20_000_000, 0, InitialBaseFee, InitialBaseFee * 7 / 8},
+		{"below target", 20_000_000, 9_000_000, InitialBaseFee, 987_500_000},
+		{"minimum increase", 20_000_000, 10_000_001, 8, 9},   // el delta redondea a 0: sube 1
+		{"no minimum decrease", 20_000_000, 9_999_999, 8, 8}, // bajar puede redondear a 0
+		{"zero base fee", 20_000_000, 20_000_000, 0, 1},      // de 0 solo se sale con el mínimo
+		{"odd gas limit", 30_000_001, 20_000_000, 7_000_000_000, 7_291_666_666},
+	}
+	for _, tt := range tests {
+		parent := &BlockHeader{BlockNumber: 10, GasLimit: tt.gasLimit, GasUsed: tt.gasUsed, BaseFee: big.NewInt(tt.baseFee)}
+		have := CalcBaseFee(parent)
+		if have.Int64() != tt.want {
+			t.Errorf("%s: have %v, want %d", tt.name, have, tt.want)
+		}
+		geth := eip1559.CalcBaseFee(config, &types.Header{
+			Number:   new(big.Int).SetUint64(parent.BlockNumber),
+			GasLimit: parent.GasLimit,
+			GasUsed:  parent.GasUsed,
+			BaseFee:  parent.BaseFee,
+		})
+		if have.Cmp(geth) != 0 {
+			t.Errorf("%s: have %v, go-ethereum %v", tt.name, have, geth)
+		}
+	}
+
+	// London está activo desde el génesis: el primer bloque EIP-1559 es el 0 y
+	// lleva la base fee inicial, la que go-ethereum da al bloque del fork
+	genesis := DefaultGenesis().ToBlock()
+	forkConfig := *config
+	forkConfig.LondonBlock = big.NewInt(1)
+	if want := eip1559.CalcBaseFee(&forkConfig, &types.Header{Number: big.NewInt(0)}); genesis.Header.BaseFee.Cmp(want) != 0 ||
+		want.Uint64() != params.InitialBaseFee {
+		t.Fatalf("genesis base fee %v, want %v", genesis.Header.BaseFee, want)
+	}
+	// Un génesis vacío baja la base fee de su hijo 1/8
+	if have := CalcBaseFee(genesis.Header); have.Int64() != InitialBaseFee*7/8 {
+		t.Fatalf("base fee of block #1: have %v, want %d", have, InitialBaseFee*7/8)
+	}
+}
+
+// TestBaseFeeBurn comprueba que el coinbase solo cobra la propina y que
+// baseFee*gasUsed desaparece del total de balances.
+func TestBaseFeeBurn(t *testing.T) {
+	bc, _, key := newTestChain(t, storage.NewMemoryDB())
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	coinbase, to := common.HexToAddress("0xc0"), common.HexToAddress("0x1234")
+	total := func() *uint256.Int {
+		state := bc.State()
+		sum := new(uint256.Int)
+		for _, addr := range []common.Address{sender, coinbase, to} {
+			sum.Add(sum, state.GetBalance(addr))
+		}
+		return sum
+	}
+	before, senderBefore := total(), bc.State().GetBalance(sender)
+
+	block := buildBlock(t, bc, bc.Genesis(), coinbase, newTestTx(t, key, 0, &to, nil), newTestTx(t, key, 1, &to, nil))
+	insertBlocks(t, bc, block)
+	gasUsed, baseFee := block.Header.GasUsed, uint256.MustFromBig(block.Header.BaseFee)
+	if gasUsed != 2*params.TxGas || baseFee.IsZero() {
+		t.Fatalf("block #1: gas used %d, base fee %v", gasUsed, baseFee)
+	}
+
+	// newTestTx paga 1 wei de propina por gas y transfiere 1 wei
+	tip := uint256.NewInt(gasUsed)
+	if have := bc.State().GetBalance(coinbase); !have.Eq(tip) {
+		t.Fatalf("coinbase balance %v, want the tips %v", have, tip)
+	}
+	burnt := new(uint256.Int).Mul(baseFee, uint256.NewInt(gasUsed))
+	if have := new(uint256.Int).Sub(before, total()); !have.Eq(burnt) {
+		t.Fatalf("burnt %v, want baseFee*gasUsed = %v", have, burnt)
+	}
+	spent := new(uint256.Int).Add(burnt, tip)
+	spent.Add(spent, uint256.NewInt(2))
+	if have := new(uint256.Int).Sub(senderBefore, bc.State().GetBalance(sender)); !have.Eq(spent) {
+		t.Fatalf("sender paid %v, want %v", have, spent)
+	}
+}
@@ -0,0 +1,68 @@
+// core/evm.go
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// ChainContext da acceso a los bloques anteriores mientras se ejecuta uno
+// nuevo (lo necesita el opcode BLOCKHASH).
+type ChainContext interface {
+	GetHeader(hash common.Hash) *BlockHeader
+}
+
+// NewEVMBlockContext crea el contexto de bloque que ve la EVM al ejecutar
+// transacciones dentro de `header`.
+func NewEVMBlockContext(header *BlockHeader, chain ChainContext) vm.BlockContext {
+	// No hay beacon chain: PREVRANDAO es siempre cero, pero tiene que estar
+	// definido para que la EVM active las reglas post-merge (Shanghai, Cancun)
+	random := common.Hash{}
+	return vm.BlockContext{
+		CanTransfer: canTransfer,
+		Transfer:    transfer,
+		GetHash:     GetHashFn(header, chain),
+		Coinbase:    header.Coinbase,
+		GasLimit:    header.GasLimit,
+		BlockNumber: new(big.Int).SetUint64(header.BlockNumber),
+		Time:        header.Timestamp,
+		Difficulty:  new(big.Int),
+		BaseFee:     new(big.Int).Set(bigOrZero(header.BaseFee)),
+		BlobBaseFee: big.NewInt(1), // no hay blobs, su precio se queda en el mínimo
+		Random:      &random,
+	}
+}
+
+// GetHashFn devuelve la función que resuelve el hash del bloque n siguiendo
+// los padres de `ref`, así funciona también en ramas que no son canónicas.
+func GetHashFn(ref *BlockHeader, chain ChainContext) vm.GetHashFunc {
+	return func(n uint64) common.Hash {
+		if n >= ref.BlockNumber || chain == nil {
+			return common.Hash{}
+		}
+		hash := ref.ParentHash
+		for number := ref.BlockNumber - 1; number > n; number-- {
+			header := chain.GetHeader(hash)
+			if header == nil {
+				return common.Hash{}
+			}
+			hash = header.ParentHash
+		}
+		return hash
+	}
+}
+
+// canTransfer indica si `addr` tiene fondos suficientes para enviar `amount`.
+func canTransfer(db vm.StateDB, addr common.Address, amount *uint256.Int) bool {
+	return db.GetBalance(addr).Cmp(amount) >= 0
+}
+
+// transfer mueve `amount` de `sender` a `recipient` dentro de la EVM.
+func transfer(db vm.StateDB, sender, recipient common.Address, amount *uint256.Int) {
+	db.SubBalance(sender, amount, tracing.BalanceChangeTransfer)
+	db.AddBalance(recipient, amount, tracing.BalanceChangeTransfer)
+}
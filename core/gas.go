@@ -0,0 +1,76 @@
+// core/gas.go
+package core
+
+import "github.com/ethereum/go-ethereum/core/types"
+
+// Costes de gas (mismos valores que Ethereum)
+const (
+	TxGas                 uint64 = 21000 // coste base de cualquier transacción
+	TxGasContractCreation uint64 = 53000 // coste base de una transacción que crea un contrato
+	InitCodeWordGas       uint64 = 2     // por cada palabra de 32 bytes del initcode (EIP-3860)
+	MaxInitCodeSize              = 49152 // tamaño máximo del initcode (EIP-3860)
+	RefundQuotient        uint64 = 5     // el refund no puede superar gasUsed/5 (EIP-3529)
+	TxDataZeroGas         uint64 = 4     // por cada byte cero de Data
+	TxDataNonZeroGas      uint64 = 16    // por cada byte distinto de cero de Data
+
+	TxAccessListAddressGas    uint64 = 2400 // por cada dirección del access list (EIP-2930)
+	TxAccessListStorageKeyGas uint64 = 1900 // por cada slot del access list (EIP-2930)
+
+	DefaultGasLimit      uint64 = 30_000_000 // gas límite por bloque por defecto
+	MinGasLimit          uint64 = 5000       // gas límite mínimo de un bloque
+	GasLimitBoundDivisor uint64 = 1024       // máximo cambio del gas límite respecto al padre
+)
+
+// IntrinsicGas es el gas que consume una transacción antes de ejecutar nada:
+// el coste base más el de sus bytes de datos y su access list. Las creaciones
+// de contrato pagan además por cada palabra del initcode.
+func IntrinsicGas(data []byte, accessList types.AccessList, isCreate bool) uint64 {
+	gas := TxGas
+	if isCreate {
+		gas = TxGasContractCreation + InitCodeWordGas*((uint64(len(data))+31)/32)
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += TxDataZeroGas
+		} else {
+			gas += TxDataNonZeroGas
+		}
+	}
+	gas += uint64(len(accessList)) * TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * TxAccessListStorageKeyGas
+	return gas
+}
+
+// CalcGasLimit acerca el gas límite del padre al `desired`, sin cambiarlo más
+// de lo que permite GasLimitBoundDivisor (como hace geth).
+func CalcGasLimit(parentGasLimit, desired uint64) uint64 {
+	delta := parentGasLimit/GasLimitBoundDivisor - 1
+	limit := parentGasLimit
+	if desired < MinGasLimit {
+		desired = MinGasLimit
+	}
+	if limit < desired {
+		limit = parentGasLimit + delta
+		if limit > desired {
+			limit = desired
+		}
+		return limit
+	}
+	if limit > desired {
+		limit = parentGasLimit - delta
+		if limit < desired {
+			limit = desired
+		}
+	}
+	return limit
+}
+
+// verifyGasLimit comprueba que el gas límite no cambia demasiado respecto al padre.
+func verifyGasLimit(parentGasLimit, headerGasLimit uint64) bool {
+	diff := int64(parentGasLimit) - int64(headerGasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parentGasLimit / GasLimitBoundDivisor
+	return uint64(diff) < limit && headerGasLimit >= MinGasLimit
+}
@@ -1,19 +1,127 @@
 // core/genesis.go
 package core
 
-func CreateGenesisBlock() *Block {
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+var ErrInvalidGenesis = errors.New("invalid genesis")
+
+// GenesisAccount es el estado inicial de una cuenta. Code y Storage permiten
+// desplegar contratos directamente en el génesis.
+type GenesisAccount struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+// GenesisAlloc asigna el estado inicial de cada cuenta.
+type GenesisAlloc map[common.Address]GenesisAccount
+
+// Genesis describe el bloque génesis. Dos nodos con el mismo Genesis
+// obtienen exactamente el mismo bloque 0.
+type Genesis struct {
+	Config    *ChainConfig
+	Timestamp uint64
+	GasLimit  uint64
+	BaseFee   *big.Int // si es nil se usa InitialBaseFee
+	Alloc     GenesisAlloc
+}
+
+// DefaultGenesis devuelve el génesis de la red de desarrollo.
+func DefaultGenesis() *Genesis {
+	return &Genesis{
+		Config:   DefaultChainConfig(),
+		GasLimit: DefaultGasLimit,
+		Alloc: GenesisAlloc{
+			// Cuenta de desarrollo de ganache/truffle, su clave privada es
+			// pública: con ella está firmada (EIP-155, chain id 1337) la TX de
+			// ejemplo del README. Sustituye a 0x4709421B..., de la que no hay
+			// clave con la que firmar la demo
+			common.HexToAddress("0x627306090abaB3A6e1400e9345bC60c78a8BEf57"): {Balance: new(big.Int).Mul(big.NewInt(9), big.NewInt(1e18)), Nonce: 1}, // 9 ETH
+		},
+	}
+}
+
+// Validate comprueba que de este génesis puede salir una cadena: con un gas
+// límite menor que MinGasLimit ningún hijo pasaría verifyGasLimit, y sin
+// chain ID no se podrían verificar las firmas EIP-155.
+func (g *Genesis) Validate() error {
+	if g.GasLimit < MinGasLimit {
+		return fmt.Errorf("%w: gas limit %d below minimum %d", ErrInvalidGenesis, g.GasLimit, MinGasLimit)
+	}
+	if g.BaseFee != nil && g.BaseFee.Sign() < 0 {
+		return fmt.Errorf("%w: negative base fee %v", ErrInvalidGenesis, g.BaseFee)
+	}
+	if g.Config != nil && (g.Config.ChainID == nil || g.Config.ChainID.Sign() <= 0) {
+		return fmt.Errorf("%w: chain id must be positive, have %v", ErrInvalidGenesis, g.Config.ChainID)
+	}
+	return nil
+}
+
+// ToState construye el estado inicial a partir del alloc, solo en memoria.
+func (g *Genesis) ToState() (*State, error) {
+	return g.toState(NewStateDatabase(storage.NewMemoryDB()))
+}
+
+// toState construye el estado inicial sobre `db`; hay que hacer Commit para guardarlo.
+func (g *Genesis) toState(db *StateDatabase) (*State, error) {
+	state := newState(db)
+	stx := state.Begin()
+	for addr, account := range g.Alloc {
+		stx.SetBalance(addr, uint256.MustFromBig(bigOrZero(account.Balance)))
+		stx.SetNonce(addr, account.Nonce)
+		stx.SetCode(addr, account.Code)
+		for key, value := range account.Storage {
+			stx.SetState(addr, key, value)
+		}
+	}
+	stx.Commit()
+	if err := state.UpdateMerkle(); err != nil {
+		return nil, fmt.Errorf("genesis state root: %w", err)
+	}
+	return state, nil
+}
+
+// ToBlock construye el bloque génesis con la raíz del estado inicial. Como en
+// geth, si no se puede calcular la raíz (algo que no debería pasar con una
+// base de datos en memoria) hace panic.
+func (g *Genesis) ToBlock() *Block {
 	// Podríamos configurar un "alloc" de cuentas, balances iniciales, etc.
 	genesisTxs := []*RawTx{
 		// Transacciones especiales para asignar tokens a ciertas direcciones
 	}
 
+	state, err := g.ToState()
+	if err != nil {
+		panic(err)
+	}
+	stateRoot := state.Root()
+	baseFee := g.BaseFee
+	if baseFee == nil {
+		baseFee = big.NewInt(InitialBaseFee)
+	}
+
 	// Normalmente su "parentHash" es 0x00... y su blockNumber es 0
-	genesis := NewBlock(
-		"0x0000000000000000",
-		0,
-		genesisTxs,
-		"0xGENESIS_STATE_ROOT", // algo predefinido o calculado
-	)
+	genesis := NewBlock(&BlockHeader{
+		ParentHash:  common.Hash{},
+		Timestamp:   g.Timestamp,
+		BlockNumber: 0,
+		StateRoot:   stateRoot, // misma raíz que calcularía geth con el mismo alloc
+		GasLimit:    g.GasLimit,
+		BaseFee:     baseFee,
+	}, genesisTxs, nil)
 
 	return genesis
 }
+
+func CreateGenesisBlock() *Block {
+	return DefaultGenesis().ToBlock()
+}
@@ -0,0 +1,70 @@
+// core/genesis_test.go
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	gethstate "github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+func TestGenesisValidate(t *testing.T) {
+	if err := DefaultGenesis().Validate(); err != nil {
+		t.Fatalf("default genesis rejected: %v", err)
+	}
+	for name, genesis := range map[string]*Genesis{
+		"zero gas limit":   {GasLimit: 0},
+		"low gas limit":    {GasLimit: MinGasLimit - 1},
+		"negative basefee": {GasLimit: DefaultGasLimit, BaseFee: big.NewInt(-1)},
+		"no chain id":      {GasLimit: DefaultGasLimit, Config: &ChainConfig{}},
+	} {
+		if err := genesis.Validate(); !errors.Is(err, ErrInvalidGenesis) {
+			t.Errorf("%s: have %v, want ErrInvalidGenesis", name, err)
+		}
+		if _, err := NewBlockchain(storage.NewMemoryDB(), genesis, nil); !errors.Is(err, ErrInvalidGenesis) {
+			t.Errorf("%s: NewBlockchain returned %v, want ErrInvalidGenesis", name, err)
+		}
+	}
+}
+
+// TestGenesisRootMatchesGeth comprueba que la raíz del génesis es la misma que
+// calcula el StateDB de go-ethereum con el mismo alloc, también para una
+// cuenta con código y storage.
+func TestGenesisRootMatchesGeth(t *testing.T) {
+	genesis := DefaultGenesis()
+	genesis.Alloc[common.HexToAddress("0x00000000000000000000000000000000000000aa")] = GenesisAccount{
+		Balance: big.NewInt(1),
+		Nonce:   1,
+		Code:    common.FromHex("60003560005560006000f3"),
+		Storage: map[common.Hash]common.Hash{
+			{0x01}: common.HexToHash("0x2a"),
+			{0x02}: common.HexToHash("0xdeadbeef"),
+		},
+	}
+	genesis.Alloc[common.HexToAddress("0x00000000000000000000000000000000000000bb")] = GenesisAccount{
+		Balance: big.NewInt(0),
+		Code:    common.FromHex("00"),
+	}
+
+	statedb, err := gethstate.New(types.EmptyRootHash, gethstate.NewDatabaseForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, account := range genesis.Alloc {
+		statedb.SetBalance(addr, uint256.MustFromBig(bigOrZero(account.Balance)), tracing.BalanceChangeUnspecified)
+		statedb.SetNonce(addr, account.Nonce)
+		statedb.SetCode(addr, account.Code)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	if have, want := genesis.ToBlock().Header.StateRoot, statedb.IntermediateRoot(false); have != want {
+		t.Fatalf("genesis state root: have %s, want %s (go-ethereum)", have.Hex(), want.Hex())
+	}
+}
@@ -0,0 +1,118 @@
+// core/journal.go
+package core
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+)
+
+// journalEntry es un cambio del estado que se sabe deshacer. revert se llama
+// con s.mu tomado y no apunta nada en el journal.
+type journalEntry interface {
+	revert(s *State)
+}
+
+// Cada modificación de State apunta una entrada con el valor anterior. La
+// cuenta vuelve a quedar sucia al deshacerla: UpdateMerkle reescribirá el
+// valor original, que es lo mismo que no haberla tocado.
+type (
+	// createAccountChange: la cuenta no existía antes del cambio
+	createAccountChange struct {
+		address common.Address
+	}
+	balanceChange struct {
+		address common.Address
+		prev    *uint256.Int
+	}
+	nonceChange struct {
+		address common.Address
+		prev    uint64
+	}
+	codeChange struct {
+		address  common.Address
+		prevHash common.Hash // el código anterior sigue en s.code, basta con el hash
+	}
+	storageChange struct {
+		address common.Address
+		slot    common.Hash
+		prev    common.Hash
+	}
+	// deleteAccountChange guarda todo lo que DeleteAccount descarta. Pueden
+	// ser valores compartidos con otras copias del estado: al deshacer se
+	// vuelven a poner copias
+	deleteAccountChange struct {
+		address     common.Address
+		prev        *Account
+		storage     *cowMap[common.Hash, common.Hash]
+		storageTrie *trie.Trie
+		dirtySlots  map[common.Hash]struct{}
+	}
+)
+
+func (ch createAccountChange) revert(s *State) {
+	s.accounts.delete(ch.address)
+	s.dirty[ch.address] = struct{}{}
+}
+
+func (ch balanceChange) revert(s *State) {
+	s.mutableAccount(ch.address).Balance = ch.prev
+	s.dirty[ch.address] = struct{}{}
+}
+
+func (ch nonceChange) revert(s *State) {
+	s.mutableAccount(ch.address).Nonce = ch.prev
+	s.dirty[ch.address] = struct{}{}
+}
+
+func (ch codeChange) revert(s *State) {
+	s.mutableAccount(ch.address).CodeHash = ch.prevHash
+	s.dirty[ch.address] = struct{}{}
+}
+
+func (ch storageChange) revert(s *State) {
+	s.setStorage(ch.address, ch.slot, ch.prev)
+}
+
+func (ch deleteAccountChange) revert(s *State) {
+	if ch.prev == nil {
+		return // la cuenta no existía, DeleteAccount no borró nada
+	}
+	prev := *ch.prev
+	s.accounts.set(ch.address, &prev)
+	if ch.storage != nil {
+		s.storage.set(ch.address, ch.storage.copy())
+	}
+	if ch.storageTrie != nil {
+		s.storageTries.set(ch.address, ch.storageTrie.Copy())
+	}
+	if ch.dirtySlots != nil {
+		s.dirtySlots[ch.address] = ch.dirtySlots
+	}
+	s.dirty[ch.address] = struct{}{}
+}
+
+// snapshot devuelve un identificador del estado actual para volver a él con
+// revertToSnapshot. Los snapshots son válidos hasta el siguiente UpdateMerkle.
+// Se usa desde StateTx, que retiene el escritor.
+func (s *State) snapshot() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.journal)
+}
+
+// revertToSnapshot deshace, en orden inverso, todos los cambios de balance,
+// nonce, código, storage y cuentas posteriores al snapshot `id`.
+func (s *State) revertToSnapshot(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 0 || id > len(s.journal) {
+		panic(fmt.Sprintf("state snapshot %d cannot be reverted (journal has %d entries)", id, len(s.journal)))
+	}
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i].revert(s)
+	}
+	s.journal = s.journal[:id]
+}
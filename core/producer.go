@@ -0,0 +1,205 @@
+// core/producer.go
+package core
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProducerConfig configura la producción de bloques.
+type ProducerConfig struct {
+	BlockTime      time.Duration  // cada cuánto se sella un bloque
+	MaxTxsPerBlock int            // máximo de transacciones por bloque
+	GasLimit       uint64         // gas límite objetivo de cada bloque
+	Coinbase       common.Address // dirección que recibe las fees
+}
+
+// DefaultProducerConfig son los valores por defecto del nodo.
+var DefaultProducerConfig = ProducerConfig{
+	BlockTime:      2 * time.Second,
+	MaxTxsPerBlock: 1000,
+	GasLimit:       DefaultGasLimit,
+}
+
+// BlockProducer sella, en cada tick, un bloque con las transacciones
+// ejecutables del pool.
+type BlockProducer struct {
+	config ProducerConfig
+	bc     *Blockchain
+	pool   *TxPool
+	quit   chan struct{}
+}
+
+// NewBlockProducer crea un productor sobre la cadena y el pool dados.
+func NewBlockProducer(bc *Blockchain, pool *TxPool, config ProducerConfig) *BlockProducer {
+	return &BlockProducer{
+		config: config,
+		bc:     bc,
+		pool:   pool,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start lanza el bucle de producción en segundo plano.
+func (p *BlockProducer) Start() {
+	log.Printf("[Producer] Sealing a block every %v (max %d txs, gas limit %d, coinbase %s)\n",
+		p.config.BlockTime, p.config.MaxTxsPerBlock, p.config.GasLimit, p.config.Coinbase.Hex())
+	go p.loop()
+}
+
+// Stop detiene el bucle de producción.
+func (p *BlockProducer) Stop() {
+	close(p.quit)
+}
+
+func (p *BlockProducer) loop() {
+	ticker := time.NewTicker(p.config.BlockTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := p.ProduceBlock(); err != nil {
+				log.Printf("[Producer] Failed to produce block: %v\n", err)
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// ProduceBlock construye un bloque sobre la cabeza actual con las transacciones
+// pendientes, ordenadas por precio y nonce, hasta llenar el gas límite o
+// MaxTxsPerBlock, y lo inserta en la cadena.
+// Si no hay nada que incluir no se sella ningún bloque y devuelve nil.
+func (p *BlockProducer) ProduceBlock() (*Block, error) {
+	parent := p.bc.CurrentBlock()
+	parentState, err := p.bc.ReadStateAt(parent.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("state of parent #%d: %w", parent.Header.BlockNumber, err)
+	}
+	state := parentState.Copy()
+	header := NewHeader(parent, p.config.Coinbase, CalcGasLimit(parent.Header.GasLimit, p.config.GasLimit))
+
+	var (
+		txs      []*RawTx
+		receipts []*Receipt
+		usedGas  uint64
+	)
+	ordered := newTxsByPriceAndNonce(p.pool.Pending(), header.BaseFee)
+	for len(txs) < p.config.MaxTxsPerBlock {
+		tx, from := ordered.Peek()
+		if tx == nil {
+			break
+		}
+		// Si la TX se rechaza ApplyTransaction descarta sus cambios, no queda nada suyo en el bloque
+		receipt, err := ApplyTransaction(p.bc.Config(), p.bc, state, header, from, tx, &usedGas)
+		if errors.Is(err, ErrGasLimitReached) || errors.Is(err, ErrFeeCapTooLow) {
+			// No cabe en este bloque o no paga la base fee actual: la cuenta espera al siguiente
+			ordered.Pop()
+			continue
+		}
+		if err != nil {
+			// La TX ya no es ejecutable: la quitamos junto con las siguientes de la cuenta
+			log.Printf("[Producer] Dropping tx from %s nonce %d: %v\n", from.Hex(), tx.Nonce, err)
+			p.pool.RemoveFrom(from, tx.Nonce)
+			ordered.Pop()
+			continue
+		}
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+		ordered.Shift()
+	}
+	if len(txs) == 0 {
+		return nil, nil
+	}
+
+	if err := state.UpdateMerkle(); err != nil {
+		return nil, err
+	}
+	header.StateRoot = state.Root()
+	header.GasUsed = usedGas
+	block := NewBlock(header, txs, receipts)
+	if err := p.bc.InsertBlock(block); err != nil {
+		return nil, err
+	}
+	log.Printf("[Producer] Sealed block #%d with %d txs, gas used %d\n", block.Header.BlockNumber, len(txs), usedGas)
+	return block, nil
+}
+
+// txsByPriceAndNonce recorre las transacciones pendientes respetando el orden
+// de nonce de cada cuenta y, entre cuentas, la mayor propina efectiva primero.
+type txsByPriceAndNonce struct {
+	txs   map[common.Address][]*RawTx // resto de transacciones de cada cuenta
+	heads priceHeap                   // siguiente transacción de cada cuenta
+}
+
+type senderTx struct {
+	from common.Address
+	tx   *RawTx
+}
+
+type priceHeap struct {
+	baseFee *big.Int
+	list    []senderTx
+}
+
+func (h priceHeap) Len() int { return len(h.list) }
+func (h priceHeap) Less(i, j int) bool {
+	// Con la misma base fee para todos, ordenar por precio efectivo es ordenar por propina
+	return h.list[i].tx.EffectiveGasPrice(h.baseFee).Cmp(h.list[j].tx.EffectiveGasPrice(h.baseFee)) > 0
+}
+func (h priceHeap) Swap(i, j int) { h.list[i], h.list[j] = h.list[j], h.list[i] }
+func (h *priceHeap) Push(x any)   { h.list = append(h.list, x.(senderTx)) }
+func (h *priceHeap) Pop() any {
+	old := h.list
+	n := len(old)
+	x := old[n-1]
+	h.list = old[:n-1]
+	return x
+}
+
+func newTxsByPriceAndNonce(pending map[common.Address][]*RawTx, baseFee *big.Int) *txsByPriceAndNonce {
+	t := &txsByPriceAndNonce{
+		txs:   make(map[common.Address][]*RawTx),
+		heads: priceHeap{baseFee: baseFee},
+	}
+	for from, txs := range pending {
+		if len(txs) == 0 {
+			continue
+		}
+		t.heads.list = append(t.heads.list, senderTx{from: from, tx: txs[0]})
+		t.txs[from] = txs[1:]
+	}
+	heap.Init(&t.heads)
+	return t
+}
+
+// Peek devuelve la transacción mejor pagada disponible, o nil si no quedan.
+func (t *txsByPriceAndNonce) Peek() (*RawTx, common.Address) {
+	if t.heads.Len() == 0 {
+		return nil, common.Address{}
+	}
+	return t.heads.list[0].tx, t.heads.list[0].from
+}
+
+// Shift sustituye la cabeza por la siguiente transacción de la misma cuenta.
+func (t *txsByPriceAndNonce) Shift() {
+	from := t.heads.list[0].from
+	if txs := t.txs[from]; len(txs) > 0 {
+		t.heads.list[0].tx, t.txs[from] = txs[0], txs[1:]
+		heap.Fix(&t.heads, 0)
+		return
+	}
+	heap.Pop(&t.heads)
+}
+
+// Pop descarta la cuenta de la cabeza entera (sus siguientes nonces ya no son ejecutables).
+func (t *txsByPriceAndNonce) Pop() {
+	heap.Pop(&t.heads)
+}
@@ -0,0 +1,120 @@
+// core/proof.go
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var ErrStateNotHashed = errors.New("state has changes not yet merkleized")
+
+// proofList recoge los nodos de una prueba en orden, desde la raíz.
+type proofList [][]byte
+
+func (l *proofList) Put(key []byte, value []byte) error {
+	*l = append(*l, common.CopyBytes(value))
+	return nil
+}
+
+func (l *proofList) Delete(key []byte) error {
+	return errors.New("proofList does not support deletes")
+}
+
+// GetProof devuelve la prueba Merkle de la cuenta `address` contra Root(): los
+// nodos RLP de la trie de estado en el camino a keccak(dirección), empezando
+// por la raíz. Si la cuenta no existe, la prueba demuestra su ausencia.
+func (s *State) GetProof(address common.Address) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.dirty) > 0 || len(s.dirtySlots) > 0 {
+		return nil, ErrStateNotHashed
+	}
+	var proof proofList
+	key := crypto.Keccak256(address.Bytes())
+	if err := s.trie.Prove(key, &proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// GetStorageProof devuelve la prueba Merkle del slot `slot` de `address`
+// contra la raíz de su storage (GetStorageRoot). Una cuenta sin storage tiene
+// la raíz vacía y la prueba no lleva ningún nodo.
+func (s *State) GetStorageProof(address common.Address, slot common.Hash) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.dirty) > 0 || len(s.dirtySlots) > 0 {
+		return nil, ErrStateNotHashed
+	}
+	var proof proofList
+	tr, ok := s.storageTries.get(address)
+	if !ok {
+		return proof, nil
+	}
+	if err := tr.Prove(crypto.Keccak256(slot[:]), &proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// verifyProof comprueba que `proof` lleva desde `root` hasta la clave `key`
+// y devuelve el valor guardado, o nil si la prueba demuestra que no existe.
+func verifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	if root == types.EmptyRootHash && len(proof) == 0 {
+		return nil, nil // trie vacía: no hay nada que probar
+	}
+	nodes := memorydb.New()
+	for _, node := range proof {
+		nodes.Put(crypto.Keccak256(node), node)
+	}
+	return trie.VerifyProof(root, key, nodes)
+}
+
+// VerifyAccountProof comprueba una prueba de GetProof (o de eth_getProof)
+// contra la raíz de estado `root`, que el cliente debe sacar de una cabecera
+// en la que confía. Devuelve la cuenta probada, o nil si la prueba demuestra
+// que la cuenta no existe.
+func VerifyAccountProof(root common.Hash, address common.Address, proof [][]byte) (*Account, error) {
+	value, err := verifyProof(root, crypto.Keccak256(address.Bytes()), proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account proof for %s: %w", address.Hex(), err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	var data types.StateAccount
+	if err := rlp.DecodeBytes(value, &data); err != nil {
+		return nil, fmt.Errorf("invalid account proof for %s: %w", address.Hex(), err)
+	}
+	return &Account{
+		Nonce:       data.Nonce,
+		Balance:     data.Balance,
+		CodeHash:    common.BytesToHash(data.CodeHash),
+		StorageRoot: data.Root,
+	}, nil
+}
+
+// VerifyStorageProof comprueba una prueba de GetStorageProof contra la raíz
+// de storage de la cuenta (la de VerifyAccountProof) y devuelve el valor del
+// slot, cero si no existe.
+func VerifyStorageProof(storageRoot common.Hash, slot common.Hash, proof [][]byte) (common.Hash, error) {
+	value, err := verifyProof(storageRoot, crypto.Keccak256(slot[:]), proof)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid storage proof for slot %s: %w", slot.Hex(), err)
+	}
+	if value == nil {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(value)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid storage proof for slot %s: %w", slot.Hex(), err)
+	}
+	return common.BytesToHash(content), nil
+}
@@ -0,0 +1,131 @@
+// core/proof_test.go
+package core
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// newProofState crea un estado con bastantes cuentas para que la trie tenga
+// varios niveles y un contrato con código y storage.
+func newProofState(t *testing.T) (*State, common.Address) {
+	t.Helper()
+	contract := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	state := NewState()
+	stx := state.Begin()
+	for i := 0; i < 200; i++ {
+		stx.SetBalance(benchAddress(i), uint256.NewInt(uint64(i+1)))
+		stx.SetNonce(benchAddress(i), uint64(i))
+	}
+	stx.SetCode(contract, storeInitCode)
+	for i := 1; i <= 50; i++ {
+		stx.SetState(contract, slotKey(i), common.BigToHash(uint256.NewInt(uint64(i*1000)).ToBig()))
+	}
+	stx.Commit()
+	if err := state.UpdateMerkle(); err != nil {
+		t.Fatal(err)
+	}
+	return state, contract
+}
+
+// tamper devuelve una copia de la prueba con un byte del nodo `i` cambiado.
+func tamper(proof [][]byte, i int) [][]byte {
+	cpy := make([][]byte, len(proof))
+	for j := range proof {
+		cpy[j] = common.CopyBytes(proof[j])
+	}
+	cpy[i][len(cpy[i])-1] ^= 0x01
+	return cpy
+}
+
+func TestVerifyAccountProof(t *testing.T) {
+	state, contract := newProofState(t)
+	root := state.Root()
+
+	for _, addr := range []common.Address{benchAddress(7), contract} {
+		proof, err := state.GetProof(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc, err := VerifyAccountProof(root, addr, proof)
+		if err != nil {
+			t.Fatalf("proof of %s: %v", addr.Hex(), err)
+		}
+		want, _ := state.GetAccount(addr)
+		if acc == nil || acc.Nonce != want.Nonce || !acc.Balance.Eq(want.Balance) ||
+			acc.CodeHash != want.CodeHash || acc.StorageRoot != want.StorageRoot {
+			t.Fatalf("proven account %s: have %+v, want %+v", addr.Hex(), acc, want)
+		}
+
+		if _, err := VerifyAccountProof(root, addr, tamper(proof, len(proof)-1)); err == nil {
+			t.Fatalf("tampered proof of %s accepted", addr.Hex())
+		}
+		if _, err := VerifyAccountProof(crypto.Keccak256Hash([]byte("other")), addr, proof); err == nil {
+			t.Fatalf("proof of %s accepted against a wrong root", addr.Hex())
+		}
+	}
+
+	// La prueba de una cuenta que no existe demuestra su ausencia
+	missing := common.HexToAddress("0xdead")
+	proof, err := state.GetProof(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc, err := VerifyAccountProof(root, missing, proof); err != nil || acc != nil {
+		t.Fatalf("absence proof: account %+v, err %v", acc, err)
+	}
+	// Con la prueba de otra cuenta no se demuestra nada sobre ella
+	other, _ := state.GetProof(benchAddress(7))
+	if acc, err := VerifyAccountProof(root, missing, other); err == nil && acc != nil {
+		t.Fatal("proof of another account proved the missing one exists")
+	}
+}
+
+func TestVerifyStorageProof(t *testing.T) {
+	state, contract := newProofState(t)
+	storageRoot, err := state.GetStorageRoot(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storageRoot == types.EmptyRootHash {
+		t.Fatal("contract has no storage")
+	}
+
+	for _, slot := range []common.Hash{slotKey(1), slotKey(33), slotKey(50)} {
+		proof, err := state.GetStorageProof(contract, slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := VerifyStorageProof(storageRoot, slot, proof)
+		if err != nil || value != state.GetState(contract, slot) {
+			t.Fatalf("slot %x: have %x (%v), want %x", slot, value, err, state.GetState(contract, slot))
+		}
+		if _, err := VerifyStorageProof(storageRoot, slot, tamper(proof, 0)); err == nil {
+			t.Fatalf("tampered proof of slot %x accepted", slot)
+		}
+		if _, err := VerifyStorageProof(state.Root(), slot, proof); err == nil {
+			t.Fatalf("proof of slot %x accepted against the state root", slot)
+		}
+	}
+
+	// Un slot vacío se prueba con valor cero
+	proof, err := state.GetStorageProof(contract, slotKey(999))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := VerifyStorageProof(storageRoot, slotKey(999), proof); err != nil || value != (common.Hash{}) {
+		t.Fatalf("empty slot: have %x (%v)", value, err)
+	}
+	// Una cuenta sin storage tiene la raíz vacía y la prueba no lleva nodos
+	proof, err = state.GetStorageProof(benchAddress(7), slotKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := VerifyStorageProof(types.EmptyRootHash, slotKey(1), proof); err != nil || value != (common.Hash{}) {
+		t.Fatalf("slot of an account without storage: have %x (%v)", value, err)
+	}
+}
@@ -0,0 +1,84 @@
+// core/receipt.go
+package core
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// ReceiptStatusFailed es el estado de una transacción que falló al ejecutarse
+	ReceiptStatusFailed = uint64(0)
+	// ReceiptStatusSuccessful es el estado de una transacción ejecutada correctamente
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Receipt guarda el resultado de ejecutar una transacción.
+type Receipt struct {
+	// Campos de consenso (entran en el ReceiptsRoot)
+	Type              uint8
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             types.Bloom
+	Logs              []*types.Log
+
+	// Campos que se conocen al ejecutar la TX
+	TxHash            common.Hash
+	From              common.Address
+	ContractAddress   common.Address // solo en creación de contratos
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+
+	// Campos que se rellenan al guardar el bloque (DeriveFields)
+	BlockHash        common.Hash
+	BlockNumber      uint64
+	TransactionIndex uint
+}
+
+// receiptRLP es la parte del recibo que se compromete en el ReceiptsRoot:
+// rlp([status, cumulativeGasUsed, bloom, logs]), igual que en Ethereum.
+type receiptRLP struct {
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             types.Bloom
+	Logs              []*types.Log
+}
+
+// Receipts es la lista de recibos de un bloque, en el orden de sus transacciones.
+type Receipts []*Receipt
+
+// Len implementa types.DerivableList
+func (rs Receipts) Len() int { return len(rs) }
+
+// EncodeIndex implementa types.DerivableList con la codificación de consenso
+// del recibo i; los recibos de TX tipadas llevan delante su tipo (EIP-2718).
+func (rs Receipts) EncodeIndex(i int, w *bytes.Buffer) {
+	r := rs[i]
+	if r.Type != LegacyTxType {
+		w.WriteByte(r.Type)
+	}
+	rlp.Encode(w, &receiptRLP{Status: r.Status, CumulativeGasUsed: r.CumulativeGasUsed, Bloom: r.Bloom, Logs: r.Logs})
+}
+
+// DeriveFields rellena los campos de bloque de los recibos y de sus logs.
+func (rs Receipts) DeriveFields(block *Block) {
+	hash := block.Hash()
+	var logIndex uint
+	for i, r := range rs {
+		r.BlockHash = hash
+		r.BlockNumber = block.Header.BlockNumber
+		r.TransactionIndex = uint(i)
+		for _, l := range r.Logs {
+			l.BlockHash = hash
+			l.BlockNumber = block.Header.BlockNumber
+			l.TxHash = r.TxHash
+			l.TxIndex = uint(i)
+			l.Index = logIndex
+			logIndex++
+		}
+	}
+}
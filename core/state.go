@@ -2,112 +2,491 @@
 package core
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"errors"
-	"github.com/cbergoon/merkletree" // ejemplo de librería Merkle Tree (3rd party)
+	"fmt"
 	"sync"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
 )
 
-// State representaría la estructura de balances y su Merkle Trie
+// Account es una cuenta del estado, como en Ethereum: nonce, balance, hash de
+// su código y raíz de su storage. Las cuentas sin código tienen EmptyCodeHash
+// y las que no tienen storage EmptyRootHash.
+type Account struct {
+	Nonce       uint64
+	Balance     *uint256.Int // 256 bits, como en Ethereum
+	CodeHash    common.Hash
+	StorageRoot common.Hash
+}
+
+func newAccount() *Account {
+	return &Account{Balance: new(uint256.Int), CodeHash: types.EmptyCodeHash, StorageRoot: types.EmptyRootHash}
+}
+
+// State representaría la estructura de cuentas y su Merkle Trie.
+//
+// Las tries (la de cuentas y una de storage por contrato) se mantienen entre
+// bloques: cada modificación marca la cuenta (o el slot) como sucia y
+// UpdateMerkle solo reescribe esas entradas, así que únicamente se vuelven a
+// hashear los caminos que cambiaron en lugar de reconstruirlo todo.
+//
+// Los nodos de las tries viven en un StateDatabase: Commit guarda en él los
+// nodos nuevos y OpenState reconstruye el estado a partir de una raíz.
+//
+// El estado solo se modifica a través de un StateTx (ver Begin), con un único
+// escritor a la vez. Cada cambio se apunta en un journal con su valor
+// anterior, así el StateTx puede deshacer una TX o una llamada que falla.
+//
+// Las cuentas, el código, el storage y las tries de storage se guardan en
+// cowMaps: Copy comparte su contenido con el original y cuesta lo que cambió
+// desde la copia anterior, no el tamaño del estado. Por eso una *Account, el
+// storage de una cuenta o una trie de storage solo se modifican en sitio si
+// son propios del estado (ver mutableAccount y compañía); si no, se copian antes.
 type State struct {
-	Balances   map[string]uint64
-	Nonces     map[string]uint64
-	merkleTree *merkletree.MerkleTree
-	mu         sync.RWMutex
+	accounts     *cowMap[common.Address, *Account]                          // dirección -> cuenta
+	code         *cowMap[common.Hash, []byte]                               // hash del código -> bytecode
+	storage      *cowMap[common.Address, *cowMap[common.Hash, common.Hash]] // dirección -> slot -> valor (32 bytes)
+	storageTries *cowMap[common.Address, *trie.Trie]                        // trie de storage de cada contrato, clave keccak(slot)
+	trie         *trie.Trie                                                 // trie de cuentas, clave keccak(dirección)
+	dirty        map[common.Address]struct{}                                // cuentas modificadas desde el último UpdateMerkle
+	dirtySlots   map[common.Address]map[common.Hash]struct{}                // slots modificados desde el último UpdateMerkle
+	root         common.Hash                                                // raíz de la trie de estado tras el último UpdateMerkle
+	journal      []journalEntry                                             // cambios desde el último UpdateMerkle, para deshacerlos
+
+	// Lo que UpdateMerkle cambió y Commit aún no ha guardado en disco
+	db               *StateDatabase
+	pendingStorage   map[common.Address]struct{} // tries de storage modificadas
+	pendingPreimages map[common.Hash][]byte      // keccak(dirección o slot) -> dirección o slot
+	pendingCode      map[common.Hash]struct{}
+
+	// Cuentas, y sus slots, que UpdateMerkle volcó desde el último Commit: lo
+	// que cambió un bloque, para calcular su StateDiff
+	touched map[common.Address]map[common.Hash]struct{}
+
+	mu     sync.RWMutex // protege los campos; las lecturas solo toman RLock
+	writer sync.Mutex   // lo retiene el StateTx abierto, UpdateMerkle, Commit o Reset
 }
 
-// Leaf implementa la interfaz merkletree.Content
-type Leaf struct {
-	Key   string
-	Value uint64
+// NewState crea un state inicial vacío que vive solo en memoria
+func NewState() *State {
+	return newState(NewStateDatabase(storage.NewMemoryDB()))
 }
 
-func (l Leaf) CalculateHash() ([]byte, error) {
-	h := sha256.Sum256([]byte(l.Key + string(rune(l.Value))))
-	return h[:], nil
+// newState crea un estado vacío cuyos nodos se guardarán en `db`.
+func newState(db *StateDatabase) *State {
+	return &State{
+		accounts:     newCowMap[common.Address, *Account](),
+		code:         newCowMap[common.Hash, []byte](),
+		storage:      newCowMap[common.Address, *cowMap[common.Hash, common.Hash]](),
+		storageTries: newCowMap[common.Address, *trie.Trie](),
+		trie:         trie.NewEmpty(db.triedb),
+		dirty:        make(map[common.Address]struct{}),
+		dirtySlots:   make(map[common.Address]map[common.Hash]struct{}),
+		root:         types.EmptyRootHash,
+
+		db:               db,
+		pendingStorage:   make(map[common.Address]struct{}),
+		pendingPreimages: make(map[common.Hash][]byte),
+		pendingCode:      make(map[common.Hash]struct{}),
+		touched:          make(map[common.Address]map[common.Hash]struct{}),
+	}
 }
-func (l Leaf) Equals(other merkletree.Content) (bool, error) {
-	otherLeaf, ok := other.(Leaf)
-	if !ok {
-		return false, errors.New("type mismatch")
+
+// Copy devuelve una copia independiente del estado, útil para ejecutar
+// transacciones sin tocar el original (p.ej. al validar un bloque). Las
+// cuentas y el storage se comparten hasta que uno de los dos los modifica: el
+// coste es proporcional a lo que cambió desde la copia anterior.
+func (s *State) Copy() *State {
+	// Congelar los cowMaps modifica el original: hace falta el lock de escritura
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cpy := newState(s.db)
+	// El storage propio de cada cuenta pasa a ser compartido: se congela con él
+	for _, e := range s.storage.own {
+		if !e.deleted {
+			e.value.freeze()
+		}
+	}
+	cpy.accounts = s.accounts.copy()
+	cpy.code = s.code.copy()
+	cpy.storage = s.storage.copy()
+	// Las tries comparten los nodos que no cambian: al modificar una copia
+	// se crean nodos nuevos y la original no se ve afectada
+	cpy.storageTries = s.storageTries.copy()
+	cpy.trie = s.trie.Copy()
+	for k := range s.dirty {
+		cpy.dirty[k] = struct{}{}
+	}
+	for k, slots := range s.dirtySlots {
+		cpy.dirtySlots[k] = make(map[common.Hash]struct{}, len(slots))
+		for slot := range slots {
+			cpy.dirtySlots[k][slot] = struct{}{}
+		}
+	}
+	cpy.root = s.root
+	for k := range s.pendingStorage {
+		cpy.pendingStorage[k] = struct{}{}
 	}
-	return l.Key == otherLeaf.Key && l.Value == otherLeaf.Value, nil
-	//return l.Key == other.(Leaf).Key && l.Value == other.(Leaf).Value, nil
+	for hash, preimage := range s.pendingPreimages {
+		cpy.pendingPreimages[hash] = preimage
+	}
+	for hash := range s.pendingCode {
+		cpy.pendingCode[hash] = struct{}{}
+	}
+	for k, slots := range s.touched {
+		cpy.touched[k] = make(map[common.Hash]struct{}, len(slots))
+		for slot := range slots {
+			cpy.touched[k][slot] = struct{}{}
+		}
+	}
+	return cpy
 }
 
-// NewState crea un state inicial
-func NewState() *State {
-	return &State{
-		Balances:   make(map[string]uint64),
-		Nonces:     make(map[string]uint64),
-		merkleTree: nil,
+// Reset reemplaza el contenido del estado por el de `other`.
+// Se usa para adoptar un estado ya validado sin cambiar el puntero compartido.
+func (s *State) Reset(other *State) {
+	cpy := other.Copy()
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = cpy.accounts
+	s.code = cpy.code
+	s.storage = cpy.storage
+	s.storageTries = cpy.storageTries
+	s.trie = cpy.trie
+	s.dirty = cpy.dirty
+	s.dirtySlots = cpy.dirtySlots
+	s.root = cpy.root
+	s.journal = nil
+	s.db = cpy.db
+	s.pendingStorage = cpy.pendingStorage
+	s.pendingPreimages = cpy.pendingPreimages
+	s.pendingCode = cpy.pendingCode
+	s.touched = cpy.touched
+}
+
+// account devuelve la cuenta, o nil si no existe. Es de solo lectura: puede
+// compartirla con otras copias. Se llama con s.mu tomado.
+func (s *State) account(address common.Address) *Account {
+	acc, _ := s.accounts.get(address)
+	return acc
+}
+
+// mutableAccount devuelve la cuenta para modificarla en sitio, copiándola
+// antes si la comparte con otro estado, o nil si no existe. Se llama con s.mu tomado.
+func (s *State) mutableAccount(address common.Address) *Account {
+	acc := s.account(address)
+	if acc == nil || s.accounts.owns(address) {
+		return acc
+	}
+	cpy := *acc // el balance no se modifica nunca en sitio, se puede compartir
+	s.accounts.set(address, &cpy)
+	return &cpy
+}
+
+// mutableStorage devuelve el storage de la cuenta para modificarlo, creándolo
+// si no tiene y copiándolo (en O(1)) si es compartido. Se llama con s.mu tomado.
+func (s *State) mutableStorage(address common.Address) *cowMap[common.Hash, common.Hash] {
+	slots, ok := s.storage.get(address)
+	switch {
+	case !ok:
+		slots = newCowMap[common.Hash, common.Hash]()
+	case s.storage.owns(address):
+		return slots
+	default:
+		slots = slots.copy() // los compartidos están congelados: copy no los modifica
+	}
+	s.storage.set(address, slots)
+	return slots
+}
+
+// mutableStorageTrie devuelve la trie de storage de la cuenta para
+// modificarla, creándola vacía si no tiene y copiándola si es compartida.
+// Se llama con s.mu tomado.
+func (s *State) mutableStorageTrie(address common.Address) *trie.Trie {
+	tr, ok := s.storageTries.get(address)
+	switch {
+	case !ok:
+		tr = trie.NewEmpty(s.db.triedb)
+	case s.storageTries.owns(address):
+		return tr
+	default:
+		tr = tr.Copy()
 	}
+	s.storageTries.set(address, tr)
+	return tr
+}
+
+// getOrNewAccount devuelve la cuenta para modificarla, creándola vacía si no
+// existe, y la marca como sucia. Se llama con s.mu tomado.
+func (s *State) getOrNewAccount(address common.Address) *Account {
+	s.dirty[address] = struct{}{}
+	acc := s.mutableAccount(address)
+	if acc == nil {
+		acc = newAccount()
+		s.accounts.set(address, acc)
+		s.journal = append(s.journal, createAccountChange{address: address})
+	}
+	return acc
+}
+
+// GetAccount devuelve una copia de la cuenta, o nil si no existe. La raíz de
+// storage incluye los slots aún no volcados a su trie.
+func (s *State) GetAccount(address common.Address) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	acc := s.account(address)
+	if acc == nil {
+		return nil, nil
+	}
+	cpy := *acc
+	cpy.Balance = new(uint256.Int).Set(acc.Balance)
+	if len(s.dirtySlots[address]) > 0 {
+		root, err := s.storageRoot(address)
+		if err != nil {
+			return nil, err
+		}
+		cpy.StorageRoot = root
+	}
+	return &cpy, nil
 }
 
 // Métodos para manipular Nonces
-func (s *State) GetNonce(address string) uint64 {
+func (s *State) GetNonce(address common.Address) uint64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.Nonces[address]
+	if acc := s.account(address); acc != nil {
+		return acc.Nonce
+	}
+	return 0
 }
 
-func (s *State) IncrementNonce(address string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Nonces[address] = s.Nonces[address] + 1
+// setNonce cambia el nonce apuntando el anterior en el journal. Se llama con s.mu tomado.
+func (s *State) setNonce(address common.Address, nonce uint64) {
+	acc := s.getOrNewAccount(address)
+	s.journal = append(s.journal, nonceChange{address: address, prev: acc.Nonce})
+	acc.Nonce = nonce
 }
 
-// SetBalance establece un balance para una dirección
-func (s *State) SetBalance(address string, amount uint64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Balances[address] = amount
+// setBalance cambia el balance apuntando el anterior en el journal. Los
+// balances nunca se modifican en sitio, así el anterior sigue siendo válido.
+// Se llama con s.mu tomado.
+func (s *State) setBalance(address common.Address, amount *uint256.Int) {
+	acc := s.getOrNewAccount(address)
+	s.journal = append(s.journal, balanceChange{address: address, prev: acc.Balance})
+	acc.Balance = amount
 }
 
-// GetBalance obtiene el balance de una dirección
-func (s *State) GetBalance(address string) uint64 {
+// GetBalance obtiene el balance de una dirección. Devuelve una copia,
+// modificarla no cambia el estado.
+func (s *State) GetBalance(address common.Address) *uint256.Int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.Balances[address]
+	if acc := s.account(address); acc != nil {
+		return new(uint256.Int).Set(acc.Balance)
+	}
+	return new(uint256.Int)
 }
 
-// AddTransaction ejemplo simplificado para añadir una transacción a "pendientes"
-func (s *State) AddTransaction(tx *RawTx) {
-	// Aquí podrías guardarlas en un pool de pendientes. Simplificado:
-	s.IncrementNonce(tx.From()) // asumiendo que RawTx tenga un método From()
-	balance := s.Balances[tx.From()]
-	if balance >= tx.Value.Uint64() {
-		s.Balances[tx.From()] -= tx.Value.Uint64()
-		s.Balances[tx.To.Hex()] += tx.Value.Uint64()
+// GetCode devuelve el bytecode de una dirección (nil si no es un contrato)
+func (s *State) GetCode(address common.Address) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if acc := s.account(address); acc != nil {
+		code, _ := s.code.get(acc.CodeHash)
+		return code
 	}
-	s.UpdateMerkle()
+	return nil
 }
 
-// UpdateMerkle actualiza la Merkle Trie del State
-func (s *State) UpdateMerkle() error {
-	var list []merkletree.Content
-	for k, v := range s.Balances {
-		list = append(list, Leaf{Key: k, Value: v})
+// GetCodeHash devuelve el hash del código de una dirección, o el hash cero si
+// la cuenta no existe.
+func (s *State) GetCodeHash(address common.Address) common.Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if acc := s.account(address); acc != nil {
+		return acc.CodeHash
 	}
-	for k, v := range s.Nonces {
-		list = append(list, Leaf{Key: "nonce_" + k, Value: v})
+	return common.Hash{}
+}
+
+// GetState devuelve el valor de un slot de storage (cero si no existe)
+func (s *State) GetState(address common.Address, key common.Hash) common.Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getState(address, key)
+}
+
+// getState es GetState con s.mu tomado.
+func (s *State) getState(address common.Address, key common.Hash) common.Hash {
+	if slots, ok := s.storage.get(address); ok {
+		value, _ := slots.get(key)
+		return value
 	}
-	tree, err := merkletree.NewTree(list)
-	if err != nil {
-		return err
+	return common.Hash{}
+}
+
+// setStorage escribe un slot sin pasar por el journal y lo marca como sucio.
+// Se llama con s.mu tomado.
+func (s *State) setStorage(address common.Address, key, value common.Hash) {
+	if s.dirtySlots[address] == nil {
+		s.dirtySlots[address] = make(map[common.Hash]struct{})
+	}
+	s.dirtySlots[address][key] = struct{}{}
+	if value == (common.Hash{}) {
+		if s.getState(address, key) == (common.Hash{}) {
+			return
+		}
+		slots := s.mutableStorage(address)
+		slots.delete(key)
+		if slots.len() == 0 {
+			s.storage.delete(address)
+		}
+		return
+	}
+	s.mutableStorage(address).set(key, value)
+}
+
+// GetStorageRoot devuelve la raíz del storage de una dirección (el hash cero
+// si la cuenta no existe). Falla si no se pueden leer de disco los nodos de
+// su trie.
+func (s *State) GetStorageRoot(address common.Address) (common.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.account(address) == nil {
+		return common.Hash{}, nil
+	}
+	return s.storageRoot(address)
+}
+
+// storageRoot devuelve la raíz de storage de una cuenta incluyendo los slots
+// aún no volcados a su trie, sin modificarla. Se llama con s.mu tomado.
+func (s *State) storageRoot(address common.Address) (common.Hash, error) {
+	tr := trie.NewEmpty(s.db.triedb)
+	if existing, ok := s.storageTries.get(address); ok {
+		tr = existing.Copy()
+	}
+	if err := s.updateStorageTrie(tr, address); err != nil {
+		return common.Hash{}, fmt.Errorf("storage root of %s: %w", address.Hex(), err)
+	}
+	return tr.Hash(), nil
+}
+
+// updateStorageTrie vuelca en `tr` los slots sucios de la cuenta, como en
+// Ethereum: clave keccak(slot), valor rlp(valor sin ceros a la izquierda).
+// Se llama con s.mu tomado.
+func (s *State) updateStorageTrie(tr *trie.Trie, address common.Address) error {
+	for slot := range s.dirtySlots[address] {
+		key := crypto.Keccak256(slot[:])
+		value := s.getState(address, slot)
+		if value == (common.Hash{}) {
+			if err := tr.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		enc, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+		if err := tr.Update(key, enc); err != nil {
+			return err
+		}
 	}
-	s.merkleTree = tree
 	return nil
 }
 
-// Root devuelve la raíz Merkle del estado
-func (s *State) Root() (string, error) {
+// Exists indica si la dirección tiene una cuenta en el estado
+func (s *State) Exists(address common.Address) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.account(address) != nil
+}
+
+// UpdateMerkle recalcula la raíz del estado: una Merkle Patricia Trie con
+// clave keccak(dirección) y valor rlp([nonce, balance, storageRoot, codeHash]),
+// igual que en Ethereum. Como la trie es canónica la raíz no depende del orden
+// de las cuentas y coincide con la de geth para el mismo estado.
+//
+// Solo se actualizan las cuentas y slots modificados desde la llamada anterior,
+// el coste es proporcional a lo que cambió y no al tamaño del estado.
+// UpdateMerkle cierra el journal: los snapshots anteriores dejan de ser válidos.
+// Espera a que termine el StateTx abierto, si lo hay.
+func (s *State) UpdateMerkle() error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	return s.updateMerkle()
+}
+
+// updateMerkle es UpdateMerkle con el escritor ya retenido.
+func (s *State) updateMerkle() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Primero las tries de storage que cambiaron, su raíz entra en la cuenta
+	for k := range s.dirtySlots {
+		acc := s.mutableAccount(k)
+		if acc == nil {
+			continue
+		}
+		tr := s.mutableStorageTrie(k)
+		if err := s.updateStorageTrie(tr, k); err != nil {
+			return err
+		}
+		s.pendingStorage[k] = struct{}{}
+		if s.touched[k] == nil {
+			s.touched[k] = make(map[common.Hash]struct{})
+		}
+		for slot := range s.dirtySlots[k] {
+			s.pendingPreimages[crypto.Keccak256Hash(slot[:])] = common.CopyBytes(slot[:])
+			s.touched[k][slot] = struct{}{}
+		}
+		acc.StorageRoot = tr.Hash()
+		s.dirty[k] = struct{}{}
+	}
+	s.dirtySlots = make(map[common.Address]map[common.Hash]struct{})
 
-	if s.merkleTree == nil {
-		return "", errors.New("Merkle Tree not initialized")
+	for k := range s.dirty {
+		if s.touched[k] == nil {
+			s.touched[k] = make(map[common.Hash]struct{})
+		}
+		key := crypto.Keccak256(k.Bytes())
+		acc := s.account(k)
+		if acc == nil {
+			if err := s.trie.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		enc, err := rlp.EncodeToBytes(&types.StateAccount{
+			Nonce:    acc.Nonce,
+			Balance:  acc.Balance,
+			Root:     acc.StorageRoot,
+			CodeHash: acc.CodeHash.Bytes(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.trie.Update(key, enc); err != nil {
+			return err
+		}
+		s.pendingPreimages[common.BytesToHash(key)] = common.CopyBytes(k.Bytes())
+		if acc.CodeHash != types.EmptyCodeHash {
+			s.pendingCode[acc.CodeHash] = struct{}{}
+		}
 	}
-	return hex.EncodeToString(s.merkleTree.MerkleRoot()), nil
+	s.dirty = make(map[common.Address]struct{})
+	s.journal = nil
+	s.root = s.trie.Hash()
+	return nil
+}
+
+// Root devuelve la raíz del estado calculada en el último UpdateMerkle
+func (s *State) Root() common.Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.root
 }
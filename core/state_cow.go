@@ -0,0 +1,142 @@
+// core/state_cow.go
+package core
+
+// cowMap es un mapa con copia barata (copy-on-write) para los mapas grandes
+// de State: cuentas, código y storage. Copiar el estado de un bloque para
+// ejecutar el siguiente no puede costar O(cuentas).
+//
+// Las entradas viven en una pila de capas inmutables que comparten todas las
+// copias, más un mapa propio con lo que este cambió desde su última copia.
+// copy congela ese mapa propio como una capa nueva y las dos copias siguen
+// sobre la misma pila, cada una con un mapa propio vacío.
+//
+// Como en un LSM, al apilar una capa se funde con la de debajo mientras esta
+// no sea más del doble de grande: así cada capa es más del doble que la de
+// encima, la pila tiene como mucho log2(entradas) capas (lo que cuesta una
+// búsqueda) y cada entrada se vuelve a copiar O(log) veces en total.
+//
+// Los valores de las capas también son compartidos: quien quiera modificar
+// uno en sitio (una *Account, un storage) primero debe copiarlo si no es
+// suyo (ver owns).
+type cowMap[K comparable, V any] struct {
+	layer *cowLayer[K, V]   // capas congeladas, compartidas con las copias
+	own   map[K]cowEntry[V] // cambios desde la última copia, solo de este mapa
+	size  int               // entradas vivas
+}
+
+// cowLayer es una capa congelada: no se modifica nunca.
+type cowLayer[K comparable, V any] struct {
+	parent *cowLayer[K, V]
+	items  map[K]cowEntry[V]
+}
+
+type cowEntry[V any] struct {
+	value   V
+	deleted bool // borrada: oculta el valor de las capas de debajo
+}
+
+func newCowMap[K comparable, V any]() *cowMap[K, V] {
+	return &cowMap[K, V]{own: make(map[K]cowEntry[V])}
+}
+
+// get devuelve el valor de `key` y si existe.
+func (m *cowMap[K, V]) get(key K) (V, bool) {
+	if e, ok := m.own[key]; ok {
+		return e.value, !e.deleted
+	}
+	for l := m.layer; l != nil; l = l.parent {
+		if e, ok := l.items[key]; ok {
+			return e.value, !e.deleted
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// owns indica si el valor de `key` está en el mapa propio: nadie más lo ve y
+// se puede modificar en sitio.
+func (m *cowMap[K, V]) owns(key K) bool {
+	e, ok := m.own[key]
+	return ok && !e.deleted
+}
+
+func (m *cowMap[K, V]) set(key K, value V) {
+	if _, ok := m.get(key); !ok {
+		m.size++
+	}
+	m.own[key] = cowEntry[V]{value: value}
+}
+
+func (m *cowMap[K, V]) delete(key K) {
+	if _, ok := m.get(key); !ok {
+		return
+	}
+	m.size--
+	if m.layer == nil {
+		delete(m.own, key)
+		return
+	}
+	m.own[key] = cowEntry[V]{deleted: true}
+}
+
+func (m *cowMap[K, V]) len() int {
+	return m.size
+}
+
+// forEach llama a `fn` con cada entrada viva, en orden arbitrario. Recorre
+// todas las capas: O(entradas).
+func (m *cowMap[K, V]) forEach(fn func(K, V)) {
+	seen := make(map[K]struct{}, m.size)
+	visit := func(items map[K]cowEntry[V]) {
+		for k, e := range items {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			if !e.deleted {
+				fn(k, e.value)
+			}
+		}
+	}
+	visit(m.own)
+	for l := m.layer; l != nil; l = l.parent {
+		visit(l.items)
+	}
+}
+
+// copy devuelve otro mapa con el mismo contenido que comparte las capas. Cuesta
+// lo que haya cambiado desde la última copia, no el tamaño del mapa. Congela
+// el mapa propio, así que modifica `m`: necesita el mismo lock que una escritura.
+func (m *cowMap[K, V]) copy() *cowMap[K, V] {
+	m.freeze()
+	return &cowMap[K, V]{layer: m.layer, own: make(map[K]cowEntry[V]), size: m.size}
+}
+
+// freeze apila el mapa propio como una capa nueva, fundiéndola con las de
+// debajo mientras no sean más del doble de grandes.
+func (m *cowMap[K, V]) freeze() {
+	if len(m.own) == 0 {
+		return
+	}
+	l := &cowLayer[K, V]{parent: m.layer, items: m.own}
+	for l.parent != nil && len(l.parent.items) <= 2*len(l.items) {
+		merged := make(map[K]cowEntry[V], len(l.parent.items)+len(l.items))
+		for k, e := range l.parent.items {
+			merged[k] = e
+		}
+		for k, e := range l.items {
+			merged[k] = e
+		}
+		l = &cowLayer[K, V]{parent: l.parent.parent, items: merged}
+	}
+	if l.parent == nil {
+		// En la capa de abajo del todo los borrados ya no ocultan nada
+		for k, e := range l.items {
+			if e.deleted {
+				delete(l.items, k)
+			}
+		}
+	}
+	m.layer = l
+	m.own = make(map[K]cowEntry[V])
+}
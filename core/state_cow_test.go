@@ -0,0 +1,65 @@
+// core/state_cow_test.go
+package core
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestCowMap compara cowMap con mapas normales copiados entero en cada copy,
+// con escrituras, borrados y copias al azar sobre varias versiones a la vez.
+func TestCowMap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	type version struct {
+		m    *cowMap[int, int]
+		want map[int]int
+	}
+	versions := []*version{{m: newCowMap[int, int](), want: make(map[int]int)}}
+	for step := 0; step < 20000; step++ {
+		v := versions[rng.Intn(len(versions))]
+		key := rng.Intn(500)
+		switch op := rng.Intn(10); {
+		case op < 6:
+			v.m.set(key, step)
+			v.want[key] = step
+		case op < 9:
+			v.m.delete(key)
+			delete(v.want, key)
+		default:
+			cpy := &version{m: v.m.copy(), want: make(map[int]int, len(v.want))}
+			for k, val := range v.want {
+				cpy.want[k] = val
+			}
+			versions = append(versions, cpy)
+		}
+	}
+	for i, v := range versions {
+		if v.m.len() != len(v.want) {
+			t.Fatalf("version %d: len %d, want %d", i, v.m.len(), len(v.want))
+		}
+		for key := 0; key < 500; key++ {
+			have, ok := v.m.get(key)
+			want, wantOk := v.want[key]
+			if ok != wantOk || have != want {
+				t.Fatalf("version %d key %d: have %d (%v), want %d (%v)", i, key, have, ok, want, wantOk)
+			}
+		}
+		seen := 0
+		v.m.forEach(func(key, value int) {
+			if v.want[key] != value {
+				t.Fatalf("version %d: forEach key %d = %d, want %d", i, key, value, v.want[key])
+			}
+			seen++
+		})
+		if seen != len(v.want) {
+			t.Fatalf("version %d: forEach saw %d entries, want %d", i, seen, len(v.want))
+		}
+		depth := 0
+		for l := v.m.layer; l != nil; l = l.parent {
+			depth++
+		}
+		if depth > 12 {
+			t.Fatalf("version %d: %d layers", i, depth)
+		}
+	}
+}
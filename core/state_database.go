@@ -0,0 +1,220 @@
+// core/state_database.go
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ethereum/go-ethereum/trie/trienode"
+	"github.com/ethereum/go-ethereum/triedb"
+)
+
+var ErrMissingState = errors.New("missing state")
+
+// StateDatabase guarda los nodos de las tries de estado en la base de datos
+// clave-valor, con el esquema "hash" de geth: cada nodo bajo su keccak. Los
+// nodos nunca se sobrescriben, así que cualquier raíz que se haya guardado
+// con Commit se puede volver a abrir.
+//
+// Junto a los nodos guarda el bytecode (por hash) y los preimages
+// keccak(dirección) -> dirección y keccak(slot) -> slot, que hacen falta para
+// reconstruir los mapas de State a partir de las claves hasheadas de la trie.
+type StateDatabase struct {
+	disk   ethdb.Database
+	triedb *triedb.Database
+
+	// Mientras hay una poda en marcha, los nodos que escribe Commit se apuntan
+	// en fresh para que el barrido no los borre. mu hace atómicas la escritura
+	// de cada Commit y cada tanda de borrados del barrido.
+	mu      sync.Mutex
+	pruning bool
+	fresh   map[common.Hash]struct{}
+}
+
+// NewStateDatabase crea la base de datos de estado sobre `db`.
+func NewStateDatabase(db storage.KeyValueStore) *StateDatabase {
+	disk := rawdb.NewDatabase(db)
+	return &StateDatabase{
+		disk:   disk,
+		triedb: triedb.NewDatabase(disk, nil), // nil: esquema hash
+	}
+}
+
+// HasState indica si los nodos de la raíz `root` están guardados.
+func (db *StateDatabase) HasState(root common.Hash) bool {
+	return root == types.EmptyRootHash || rawdb.HasLegacyTrieNode(db.disk, root)
+}
+
+// writeNodes guarda en `batch` los nodos nuevos de una trie recién confirmada
+// y apunta sus hashes en `written`. Los nodos borrados no se tocan: pueden
+// seguir formando parte de estados anteriores.
+func writeNodes(batch ethdb.KeyValueWriter, nodes *trienode.NodeSet, written map[common.Hash]struct{}) {
+	if nodes == nil {
+		return
+	}
+	for hash, blob := range nodes.HashSet() {
+		rawdb.WriteLegacyTrieNode(batch, hash, blob)
+		written[hash] = struct{}{}
+	}
+}
+
+// writeState escribe el batch de un Commit con los nodos `written`. Si hay una
+// poda en marcha los apunta antes: no se alcanzan desde las raíces que marcó
+// y el barrido los borraría.
+func (db *StateDatabase) writeState(batch ethdb.Batch, written map[common.Hash]struct{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.pruning {
+		for hash := range written {
+			db.fresh[hash] = struct{}{}
+		}
+	}
+	return batch.Write()
+}
+
+// Commit recalcula la raíz y guarda en disco los nodos de las tries, el código
+// y los preimages que cambiaron desde el Commit anterior. Después las tries se
+// vuelven a abrir desde la base de datos (una trie confirmada ya no se puede
+// modificar) y sus nodos se cargan de disco a medida que se necesitan.
+func (s *State) Commit() (common.Hash, error) {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	if err := s.updateMerkle(); err != nil {
+		return common.Hash{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.db.disk.NewBatch()
+	written := make(map[common.Hash]struct{})
+	storageRoots := make(map[common.Address]common.Hash, len(s.pendingStorage))
+	for k := range s.pendingStorage {
+		if _, ok := s.storageTries.get(k); !ok {
+			continue // la cuenta se borró después de modificar su storage
+		}
+		// Commit deja la trie inservible: si es compartida, confirmamos una copia
+		tr := s.mutableStorageTrie(k)
+		root, nodes := tr.Commit(false)
+		writeNodes(batch, nodes, written)
+		storageRoots[k] = root
+	}
+	root, nodes := s.trie.Commit(false)
+	writeNodes(batch, nodes, written)
+	rawdb.WritePreimages(batch, s.pendingPreimages)
+	for hash := range s.pendingCode {
+		code, _ := s.code.get(hash)
+		rawdb.WriteCode(batch, hash, code)
+	}
+	if err := s.db.writeState(batch, written); err != nil {
+		return common.Hash{}, fmt.Errorf("write state %x: %w", root, err)
+	}
+
+	// Reabrimos las tries confirmadas sobre los nodos recién guardados
+	tr, err := trie.New(trie.StateTrieID(root), s.db.triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	s.trie = tr
+	for k, storageRoot := range storageRoots {
+		owner := crypto.Keccak256Hash(k.Bytes())
+		str, err := trie.New(trie.StorageTrieID(root, owner, storageRoot), s.db.triedb)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		s.storageTries.set(k, str)
+	}
+	s.pendingStorage = make(map[common.Address]struct{})
+	s.pendingPreimages = make(map[common.Hash][]byte)
+	s.pendingCode = make(map[common.Hash]struct{})
+	s.touched = make(map[common.Address]map[common.Hash]struct{})
+	return root, nil
+}
+
+// OpenState reconstruye el estado guardado con raíz `root`: recorre la trie de
+// cuentas y la de storage de cada contrato y traduce sus claves con los preimages.
+func OpenState(db *StateDatabase, root common.Hash) (*State, error) {
+	s := newState(db)
+	if root == types.EmptyRootHash {
+		return s, nil
+	}
+	if !db.HasState(root) {
+		return nil, fmt.Errorf("%w: root %s", ErrMissingState, root.Hex())
+	}
+	tr, err := trie.New(trie.StateTrieID(root), db.triedb)
+	if err != nil {
+		return nil, fmt.Errorf("%w: root %s: %v", ErrMissingState, root.Hex(), err)
+	}
+	s.trie = tr
+	s.root = root
+
+	it := trie.NewIterator(tr.MustNodeIterator(nil))
+	for it.Next() {
+		preimage := rawdb.ReadPreimage(db.disk, common.BytesToHash(it.Key))
+		if preimage == nil {
+			return nil, fmt.Errorf("missing preimage for account key %x", it.Key)
+		}
+		var data types.StateAccount
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return nil, fmt.Errorf("decode account %x: %w", preimage, err)
+		}
+		addr := common.BytesToAddress(preimage)
+		s.accounts.set(addr, &Account{
+			Nonce:       data.Nonce,
+			Balance:     data.Balance,
+			CodeHash:    common.BytesToHash(data.CodeHash),
+			StorageRoot: data.Root,
+		})
+		if codeHash := common.BytesToHash(data.CodeHash); codeHash != types.EmptyCodeHash {
+			code := rawdb.ReadCode(db.disk, codeHash)
+			if code == nil {
+				return nil, fmt.Errorf("missing code %s of %s", codeHash.Hex(), addr.Hex())
+			}
+			s.code.set(codeHash, code)
+		}
+		if data.Root != types.EmptyRootHash {
+			if err := s.openStorage(root, addr, data.Root); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if it.Err != nil {
+		return nil, fmt.Errorf("%w: root %s: %v", ErrMissingState, root.Hex(), it.Err)
+	}
+	return s, nil
+}
+
+// openStorage abre la trie de storage de `addr` y carga sus slots en s.storage.
+func (s *State) openStorage(stateRoot common.Hash, addr common.Address, storageRoot common.Hash) error {
+	tr, err := trie.New(trie.StorageTrieID(stateRoot, crypto.Keccak256Hash(addr.Bytes()), storageRoot), s.db.triedb)
+	if err != nil {
+		return fmt.Errorf("%w: storage of %s: %v", ErrMissingState, addr.Hex(), err)
+	}
+	s.storageTries.set(addr, tr)
+	slots := newCowMap[common.Hash, common.Hash]()
+	it := trie.NewIterator(tr.MustNodeIterator(nil))
+	for it.Next() {
+		preimage := rawdb.ReadPreimage(s.db.disk, common.BytesToHash(it.Key))
+		if preimage == nil {
+			return fmt.Errorf("missing preimage for slot key %x of %s", it.Key, addr.Hex())
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return fmt.Errorf("decode slot of %s: %w", addr.Hex(), err)
+		}
+		slots.set(common.BytesToHash(preimage), common.BytesToHash(content))
+	}
+	if it.Err != nil {
+		return fmt.Errorf("%w: storage of %s: %v", ErrMissingState, addr.Hex(), it.Err)
+	}
+	s.storage.set(addr, slots)
+	return nil
+}
@@ -0,0 +1,119 @@
+// core/state_diff.go
+package core
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// StateDiff son los cambios que hizo un bloque en el estado: el antes y el
+// después de cada cuenta que cambió. Se calcula al importar el bloque y se
+// guarda con él, así quien quiera seguir el estado (un indexador, por
+// ejemplo) no necesita re-ejecutar la cadena.
+type StateDiff struct {
+	BlockHash   common.Hash
+	BlockNumber uint64
+	Accounts    []*AccountDiff // ordenadas por dirección
+}
+
+// AccountDiff es el cambio de una cuenta dentro de un bloque.
+type AccountDiff struct {
+	Address common.Address
+	Before  *AccountState  `rlp:"nil"` // nil si la cuenta no existía
+	After   *AccountState  `rlp:"nil"` // nil si el bloque la borró
+	Code    []byte         // el código nuevo si cambió; el anterior se obtiene por Before.CodeHash
+	Storage []*StorageDiff // slots que cambiaron, ordenados
+}
+
+// AccountState es lo que se guarda de una cuenta a cada lado del diff.
+type AccountState struct {
+	Nonce    uint64
+	Balance  *uint256.Int
+	CodeHash common.Hash
+}
+
+// StorageDiff es el cambio de un slot: cero significa que no existía o que se borró.
+type StorageDiff struct {
+	Slot   common.Hash
+	Before common.Hash
+	After  common.Hash
+}
+
+// diffStates compara `post` con `pre`, el estado del que partió, en las
+// cuentas y slots que post volcó a su trie desde su último Commit. Las
+// cuentas que se tocaron pero acabaron igual (p.ej. por un revert) no salen.
+//
+// Si el bloque borra una cuenta se listan todos sus slots anteriores. Desde
+// EIP-6780 una cuenta con storage solo se puede borrar en la misma TX que la
+// creó, así que no hace falta tratar el caso de borrar y volver a crear.
+func diffStates(pre, post *State) []*AccountDiff {
+	pre.mu.RLock()
+	defer pre.mu.RUnlock()
+	post.mu.RLock()
+	defer post.mu.RUnlock()
+
+	diffs := make([]*AccountDiff, 0, len(post.touched))
+	for addr, touched := range post.touched {
+		before, after := pre.account(addr), post.account(addr)
+		diff := &AccountDiff{
+			Address: addr,
+			Before:  accountState(before),
+			After:   accountState(after),
+		}
+		if after != nil && after.CodeHash != types.EmptyCodeHash && (before == nil || before.CodeHash != after.CodeHash) {
+			diff.Code, _ = post.code.get(after.CodeHash)
+		}
+
+		slots := touched
+		if prevSlots, ok := pre.storage.get(addr); after == nil && ok {
+			slots = make(map[common.Hash]struct{}, len(touched)+prevSlots.len())
+			for slot := range touched {
+				slots[slot] = struct{}{}
+			}
+			prevSlots.forEach(func(slot, _ common.Hash) {
+				slots[slot] = struct{}{}
+			})
+		}
+		for slot := range slots {
+			prev, value := pre.getState(addr, slot), post.getState(addr, slot)
+			if prev != value {
+				diff.Storage = append(diff.Storage, &StorageDiff{Slot: slot, Before: prev, After: value})
+			}
+		}
+		sort.Slice(diff.Storage, func(i, j int) bool {
+			return bytes.Compare(diff.Storage[i].Slot[:], diff.Storage[j].Slot[:]) < 0
+		})
+
+		if len(diff.Storage) == 0 && sameAccount(diff.Before, diff.After) {
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return bytes.Compare(diffs[i].Address[:], diffs[j].Address[:]) < 0
+	})
+	return diffs
+}
+
+func accountState(acc *Account) *AccountState {
+	if acc == nil {
+		return nil
+	}
+	return &AccountState{
+		Nonce:    acc.Nonce,
+		Balance:  new(uint256.Int).Set(acc.Balance),
+		CodeHash: acc.CodeHash,
+	}
+}
+
+// sameAccount compara nonce, balance y código; el storage se compara aparte.
+func sameAccount(a, b *AccountState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce && a.Balance.Eq(b.Balance) && a.CodeHash == b.CodeHash
+}
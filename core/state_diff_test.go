@@ -0,0 +1,144 @@
+// core/state_diff_test.go
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// storeWithConstructorInitCode es storeInitCode con un constructor que además
+// guarda 0x2a en el slot 0.
+var storeWithConstructorInitCode = common.FromHex("602a600055" + "600b6011600039600b6000f3" + "60003560005560006000f3")
+
+// accountDiff busca la cuenta `addr` en un diff.
+func accountDiff(t *testing.T, diff *StateDiff, addr common.Address) *AccountDiff {
+	t.Helper()
+	for _, acc := range diff.Accounts {
+		if acc.Address == addr {
+			return acc
+		}
+	}
+	t.Fatalf("block #%d: no diff for %s", diff.BlockNumber, addr.Hex())
+	return nil
+}
+
+func TestStateDiff(t *testing.T) {
+	db := storage.NewMemoryDB()
+	bc, genesis, key := newTestChain(t, db)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	coinbase, to := common.HexToAddress("0xc0"), common.HexToAddress("0x1234")
+	contract := crypto.CreateAddress(sender, 0)
+	initialBalance := bc.State().GetBalance(sender)
+
+	// #1: despliegue de un contrato que escribe el slot 0 en el constructor
+	b1 := buildBlock(t, bc, bc.Genesis(), coinbase, newTestTx(t, key, 0, nil, storeWithConstructorInitCode))
+	insertBlocks(t, bc, b1)
+	// #2: el contrato borra el slot 0 y una transferencia a una cuenta nueva
+	zero := common.Hash{}
+	b2 := buildBlock(t, bc, b1, coinbase, newTestTx(t, key, 1, &contract, zero[:]), newTestTx(t, key, 2, &to, nil))
+	insertBlocks(t, bc, b2)
+
+	diff1 := bc.GetStateDiff(b1.Hash())
+	if diff1 == nil || diff1.BlockHash != b1.Hash() || diff1.BlockNumber != 1 {
+		t.Fatalf("diff of #1: %+v", diff1)
+	}
+	// El emisor paga: nonce 0 -> 1 y menos balance
+	acc := accountDiff(t, diff1, sender)
+	if acc.Before == nil || acc.After == nil || acc.Before.Nonce != 0 || acc.After.Nonce != 1 ||
+		!acc.Before.Balance.Eq(initialBalance) || !acc.After.Balance.Lt(initialBalance) || len(acc.Storage) != 0 {
+		t.Fatalf("sender diff in #1: %+v -> %+v", acc.Before, acc.After)
+	}
+	// El contrato nace con su código y su slot
+	acc = accountDiff(t, diff1, contract)
+	if acc.Before != nil || acc.After == nil || acc.After.Nonce != 1 {
+		t.Fatalf("contract diff in #1: %+v -> %+v", acc.Before, acc.After)
+	}
+	if runtime := storeInitCode[12:]; !bytes.Equal(acc.Code, runtime) || acc.After.CodeHash != crypto.Keccak256Hash(runtime) {
+		t.Fatalf("deployed code: %x", acc.Code)
+	}
+	if len(acc.Storage) != 1 || acc.Storage[0].Slot != (common.Hash{}) ||
+		acc.Storage[0].Before != (common.Hash{}) || acc.Storage[0].After != common.HexToHash("0x2a") {
+		t.Fatalf("contract storage in #1: %+v", acc.Storage)
+	}
+	if acc := accountDiff(t, diff1, coinbase); acc.Before != nil || acc.After == nil || acc.After.Balance.IsZero() {
+		t.Fatalf("coinbase diff in #1: %+v -> %+v", acc.Before, acc.After)
+	}
+
+	diff2 := bc.GetStateDiff(b2.Hash())
+	// El slot borrado sale con After = 0; la llamada solo suma el value de la TX
+	acc = accountDiff(t, diff2, contract)
+	if len(acc.Storage) != 1 || acc.Storage[0].Before != common.HexToHash("0x2a") || acc.Storage[0].After != (common.Hash{}) {
+		t.Fatalf("cleared slot in #2: %+v", acc.Storage)
+	}
+	if acc.Before.Nonce != acc.After.Nonce || acc.Before.CodeHash != acc.After.CodeHash || len(acc.Code) != 0 ||
+		acc.After.Balance.Uint64() != acc.Before.Balance.Uint64()+1 {
+		t.Fatalf("contract account in #2: %+v -> %+v", acc.Before, acc.After)
+	}
+	if acc := accountDiff(t, diff2, to); acc.Before != nil || acc.After == nil || acc.After.Balance.Uint64() != 1 {
+		t.Fatalf("recipient diff in #2: %+v -> %+v", acc.Before, acc.After)
+	}
+	if acc := accountDiff(t, diff2, sender); acc.Before.Nonce != 1 || acc.After.Nonce != 3 {
+		t.Fatalf("sender nonce in #2: %d -> %d", acc.Before.Nonce, acc.After.Nonce)
+	}
+
+	// Los diffs se leen igual tras volver a abrir la base de datos
+	bc, err := NewBlockchain(db, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []*StateDiff{diff1, diff2} {
+		if got := bc.GetStateDiff(want.BlockHash); !reflect.DeepEqual(got, want) {
+			t.Fatalf("diff of #%d after reopening: %+v, want %+v", want.BlockNumber, got, want)
+		}
+	}
+}
+
+// TestStateDiffRevertedTouch comprueba que una cuenta o un slot que se tocan
+// pero acaban como estaban no salen en el diff.
+func TestStateDiffRevertedTouch(t *testing.T) {
+	a, b, c := benchAddress(0), benchAddress(1), benchAddress(2)
+	pre := NewState()
+	stx := pre.Begin()
+	stx.SetBalance(a, uint256.NewInt(100))
+	stx.SetState(a, slotKey(1), common.HexToHash("0x01"))
+	stx.SetBalance(b, uint256.NewInt(5))
+	stx.Commit()
+	if _, err := pre.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	post := pre.Copy()
+	stx = post.Begin()
+	stx.AddBalance(a, uint256.NewInt(10)) // a: +10 -10 y el slot vuelve a su valor
+	stx.SubBalance(a, uint256.NewInt(10))
+	stx.SetState(a, slotKey(1), common.HexToHash("0x02"))
+	stx.SetState(a, slotKey(1), common.HexToHash("0x01"))
+	stx.SetState(a, slotKey(2), common.HexToHash("0x03")) // slot nuevo que se vuelve a borrar
+	stx.SetState(a, slotKey(2), common.Hash{})
+	stx.AddBalance(b, uint256.NewInt(1)) // b sí cambia
+	stx.Commit()
+	// c se crea en un StateTx que se descarta: ni siquiera queda tocada
+	stx = post.Begin()
+	stx.SetBalance(c, uint256.NewInt(1))
+	stx.Discard()
+	if err := post.UpdateMerkle(); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs := diffStates(pre, post)
+	if len(diffs) != 1 || diffs[0].Address != b {
+		t.Fatalf("diff: have %d accounts, want only %s", len(diffs), b.Hex())
+	}
+	if before, after := diffs[0].Before.Balance, diffs[0].After.Balance; before.Uint64() != 5 || after.Uint64() != 6 {
+		t.Fatalf("balance of b: %v -> %v", before, after)
+	}
+	if !pre.GetBalance(a).Eq(uint256.NewInt(100)) || !pre.GetBalance(b).Eq(uint256.NewInt(5)) {
+		t.Fatal("changes to the post state reached the pre state")
+	}
+}
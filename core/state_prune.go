@@ -0,0 +1,217 @@
+// core/state_prune.go
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// DefaultGCInterval es cada cuántos bloques un nodo full borra de disco los
+// nodos de la trie que ya no forman parte de ningún estado que conserve.
+const DefaultGCInterval = 32
+
+// PruneStats resume una pasada de poda.
+type PruneStats struct {
+	Live    int                // nodos alcanzables desde las raíces conservadas
+	Deleted int                // nodos borrados
+	Freed   common.StorageSize // bytes borrados (claves y valores)
+}
+
+// ErrPruneInProgress se devuelve al pedir una poda mientras otra sigue en marcha.
+var ErrPruneInProgress = errors.New("state pruning already in progress")
+
+// Prune borra los nodos de trie guardados que no se alcanzan desde ninguna de
+// las raíces `roots`: es un mark-and-sweep. Primero se marcan los nodos de la
+// trie de cuentas de cada raíz y de la trie de storage de cada cuenta, y luego
+// se recorre la base de datos borrando los nodos sin marcar.
+//
+// Con el esquema hash un nodo se guarda una sola vez aunque lo compartan
+// muchos estados, así que no se puede borrar al cambiar un estado: solo
+// recorriendo los que se quieren conservar se sabe si alguien lo usa todavía.
+// El bytecode y los preimages no se borran.
+//
+// Se puede hacer Commit mientras se poda: los nodos escritos desde que empieza
+// la poda se conservan aunque no se alcancen desde `roots`. Abrir un estado que
+// no está en `roots` sí puede fallar con ErrMissingState si el barrido borra
+// sus nodos a mitad de la lectura.
+func (db *StateDatabase) Prune(roots []common.Hash) (*PruneStats, error) {
+	if !db.beginPrune() {
+		return nil, ErrPruneInProgress
+	}
+	return db.prune(roots)
+}
+
+// beginPrune empieza una poda: desde aquí se apuntan los nodos que escribe
+// Commit para que el barrido no los borre. Quien elige las raíces la llama
+// antes de soltar su lock, para que ningún estado confirmado después de
+// elegirlas se quede sin proteger. Devuelve false si ya hay otra en marcha.
+func (db *StateDatabase) beginPrune() bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.pruning {
+		return false
+	}
+	db.pruning = true
+	db.fresh = make(map[common.Hash]struct{})
+	return true
+}
+
+// prune hace la poda empezada con beginPrune y la termina.
+func (db *StateDatabase) prune(roots []common.Hash) (*PruneStats, error) {
+	defer func() {
+		db.mu.Lock()
+		db.pruning, db.fresh = false, nil
+		db.mu.Unlock()
+	}()
+
+	marked := make(map[common.Hash]struct{})
+	for _, root := range roots {
+		if err := db.markState(root, marked); err != nil {
+			return nil, err
+		}
+	}
+	stats := &PruneStats{Live: len(marked)}
+
+	// Los candidatos se borran por tandas con db.mu tomado, descartando los que
+	// un Commit haya vuelto a escribir desde que el barrido los vio
+	type candidate struct {
+		key  []byte
+		size int
+	}
+	var (
+		pending []candidate
+		size    int
+	)
+	flush := func() error {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		batch := db.disk.NewBatch()
+		for _, c := range pending {
+			if _, ok := db.fresh[common.BytesToHash(c.key)]; ok {
+				continue
+			}
+			if err := batch.Delete(c.key); err != nil {
+				return err
+			}
+			stats.Deleted++
+			stats.Freed += common.StorageSize(c.size)
+		}
+		if err := batch.Write(); err != nil {
+			return fmt.Errorf("delete trie nodes: %w", err)
+		}
+		pending, size = pending[:0], 0
+		return nil
+	}
+	it := db.disk.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		// Los nodos se guardan bajo su hash, sin prefijo: ninguna otra clave
+		// del esquema mide 32 bytes. Comprobamos también el hash por si acaso.
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key)
+		if _, ok := marked[hash]; ok || crypto.Keccak256Hash(it.Value()) != hash {
+			continue
+		}
+		pending = append(pending, candidate{key: common.CopyBytes(key), size: len(key) + len(it.Value())})
+		if size += len(key); size >= ethdb.IdealBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("iterate database: %w", err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// markState marca los nodos del estado con raíz `root`: los de la trie de
+// cuentas y los de la trie de storage de cada cuenta.
+func (db *StateDatabase) markState(root common.Hash, marked map[common.Hash]struct{}) error {
+	return db.markTrie(trie.StateTrieID(root), marked, func(blob []byte) error {
+		var data types.StateAccount
+		if err := rlp.DecodeBytes(blob, &data); err != nil {
+			return fmt.Errorf("decode account: %w", err)
+		}
+		return db.markTrie(trie.StorageTrieID(root, common.Hash{}, data.Root), marked, nil)
+	})
+}
+
+// markTrie marca los nodos de una trie y llama a `onLeaf` con cada hoja. Los
+// subárboles ya marcados no se recorren: otra raíz los comparte y ya se
+// visitaron enteros, hojas incluidas.
+func (db *StateDatabase) markTrie(id *trie.ID, marked map[common.Hash]struct{}, onLeaf func([]byte) error) error {
+	if id.Root == types.EmptyRootHash {
+		return nil
+	}
+	if _, ok := marked[id.Root]; ok {
+		return nil
+	}
+	tr, err := trie.New(id, db.triedb)
+	if err != nil {
+		return fmt.Errorf("%w: root %s: %v", ErrMissingState, id.Root.Hex(), err)
+	}
+	it, err := tr.NodeIterator(nil)
+	if err != nil {
+		return err
+	}
+	descend := true
+	for it.Next(descend) {
+		descend = true
+		// Los nodos de menos de 32 bytes van dentro de su padre y no tienen hash
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			if _, ok := marked[hash]; ok {
+				descend = false
+				continue
+			}
+			marked[hash] = struct{}{}
+		}
+		if it.Leaf() && onLeaf != nil {
+			if err := onLeaf(it.LeafBlob()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("%w: root %s: %v", ErrMissingState, id.Root.Hex(), err)
+	}
+	return nil
+}
+
+// PruneDatabase poda la base de datos de un nodo parado: conserva el estado de
+// los últimos `history` bloques canónicos (los mismos que sirve un nodo full
+// con StateHistory = history) y borra el resto de nodos. Los bloques laterales
+// no se cargan al arrancar, así que sus estados también se borran.
+func PruneDatabase(db storage.KeyValueStore, history uint64) (*PruneStats, error) {
+	headHash := ReadHeadBlockHash(db)
+	head := ReadBlock(db, headHash)
+	if head == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeadBlock, headHash.Hex())
+	}
+	var roots []common.Hash
+	for n := head.Header.BlockNumber; ; n-- {
+		block := ReadBlock(db, ReadCanonicalHash(db, n))
+		if block == nil {
+			return nil, fmt.Errorf("%w: canonical block #%d", ErrMissingHeadBlock, n)
+		}
+		roots = append(roots, block.Header.StateRoot)
+		if n == 0 || n+history <= head.Header.BlockNumber {
+			break
+		}
+	}
+	return NewStateDatabase(db).Prune(roots)
+}
@@ -0,0 +1,321 @@
+// core/state_prune_test.go
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/holiman/uint256"
+)
+
+// storeInitCode despliega un contrato que guarda en el slot 0 la palabra que recibe.
+var storeInitCode = common.FromHex("600b600c600039600b6000f3" + "60003560005560006000f3")
+
+// pruneTestChain produce `blocks` bloques con una transferencia a una cuenta
+// nueva y una escritura de storage cada uno, para que cada bloque deje nodos
+// viejos en disco.
+func pruneTestChain(t *testing.T, db storage.KeyValueStore, cacheConfig *CacheConfig, blocks int) (*Blockchain, *Genesis) {
+	t.Helper()
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	genesis := &Genesis{
+		Config:   DefaultChainConfig(),
+		GasLimit: DefaultGasLimit,
+		Alloc:    GenesisAlloc{sender: {Balance: big.NewInt(1e18)}},
+	}
+	bc, err := NewBlockchain(db, genesis, cacheConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewTxPool(bc, TxPoolConfig{})
+	defer pool.Stop()
+	producer := NewBlockProducer(bc, pool, DefaultProducerConfig)
+
+	contract := crypto.CreateAddress(sender, 0)
+	addTx(t, pool, key, 0, nil, storeInitCode)
+	for i := 0; i < blocks; i++ {
+		nonce := uint64(1 + 2*i)
+		to := common.BigToAddress(big.NewInt(int64(1000 + i)))
+		addTx(t, pool, key, nonce, &to, nil)
+		addTx(t, pool, key, nonce+1, &contract, common.BigToHash(big.NewInt(int64(i+1))).Bytes())
+		if _, err := producer.ProduceBlock(); err != nil {
+			t.Fatal(err)
+		}
+		// Esperamos cada poda para que se haga justo cada GCInterval bloques
+		bc.pruneWG.Wait()
+	}
+	if got := bc.State().GetState(contract, common.Hash{}); got != common.BigToHash(big.NewInt(int64(blocks))) {
+		t.Fatalf("contract slot 0: have %x, want %d", got, blocks)
+	}
+	return bc, genesis
+}
+
+func addTx(t *testing.T, pool *TxPool, key *ecdsa.PrivateKey, nonce uint64, to *common.Address, data []byte) {
+	t.Helper()
+	if _, err := pool.Add(newTestTx(t, key, nonce, to, data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countTrieNodes cuenta las claves de 32 bytes: los nodos de la trie.
+func countTrieNodes(db ethdb.Iteratee) int {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	n := 0
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			n++
+		}
+	}
+	return n
+}
+
+// checkStates comprueba que los estados de los bloques [from, to] se pueden
+// abrir y dan su StateRoot, y que el de `pruned` ya no está en disco.
+func checkStates(t *testing.T, bc *Blockchain, from, to, pruned uint64) {
+	t.Helper()
+	for n := from; n <= to; n++ {
+		root := bc.GetBlockByNumber(n).Header.StateRoot
+		state, err := OpenState(bc.statedb, root)
+		if err != nil {
+			t.Fatalf("state of block #%d: %v", n, err)
+		}
+		if err := state.UpdateMerkle(); err != nil || state.Root() != root {
+			t.Fatalf("state of block #%d: root %x, want %x (%v)", n, state.Root(), root, err)
+		}
+	}
+	if root := bc.GetBlockByNumber(pruned).Header.StateRoot; bc.statedb.HasState(root) {
+		t.Fatalf("state of block #%d was not pruned", pruned)
+	}
+}
+
+func TestPruneState(t *testing.T) {
+	const (
+		history = 4
+		blocks  = 30
+	)
+	db := storage.NewMemoryDB()
+	bc, genesis := pruneTestChain(t, db, &CacheConfig{StateHistory: history, GCInterval: 5}, blocks)
+
+	// La última poda fue en #30: conserva #26..#30
+	head := bc.CurrentBlock().Header.BlockNumber
+	checkStates(t, bc, head-history, head, 10)
+	if _, err := bc.ReadStateAt(bc.GetBlockByNumber(head - history).Hash()); err != nil {
+		t.Fatalf("state inside the window not served: %v", err)
+	}
+
+	// Un nodo archivo con la misma cadena guarda muchos más nodos
+	archiveDB := storage.NewMemoryDB()
+	pruneTestChain(t, archiveDB, &CacheConfig{Archive: true, StateHistory: history, GCInterval: 5}, blocks)
+	if pruned, archive := countTrieNodes(db), countTrieNodes(archiveDB); pruned*2 > archive {
+		t.Fatalf("pruning kept too many nodes: %d, archive has %d", pruned, archive)
+	}
+
+	// Poda offline: solo el estado de la cabeza
+	before := countTrieNodes(db)
+	stats, err := PruneDatabase(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deleted == 0 || countTrieNodes(db) != before-stats.Deleted || countTrieNodes(db) != stats.Live {
+		t.Fatalf("offline prune: %+v, %d nodes before, %d after", stats, before, countTrieNodes(db))
+	}
+
+	// La cadena se vuelve a abrir y sigue sobre el estado conservado
+	bc, err = NewBlockchain(db, genesis, &CacheConfig{StateHistory: history, GCInterval: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStates(t, bc, head, head, head-1)
+}
+
+// TestPruneConcurrentCommit comprueba que un estado confirmado después de
+// empezar la poda sobrevive al barrido aunque no esté entre sus raíces.
+func TestPruneConcurrentCommit(t *testing.T) {
+	db := NewStateDatabase(storage.NewMemoryDB())
+	commit := func(state *State, from, to int) common.Hash {
+		t.Helper()
+		stx := state.Begin()
+		for i := from; i < to; i++ {
+			stx.SetBalance(benchAddress(i), uint256.NewInt(uint64(i+1)))
+			stx.SetState(benchAddress(0), slotKey(i), common.HexToHash("0x01"))
+		}
+		stx.Commit()
+		root, err := state.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	base := newState(db)
+	kept := commit(base, 0, 100)
+	dropped := commit(base.Copy(), 100, 110)
+
+	if !db.beginPrune() {
+		t.Fatal("prune already in progress")
+	}
+	if _, err := db.Prune(nil); !errors.Is(err, ErrPruneInProgress) {
+		t.Fatalf("second prune: have %v, want %v", err, ErrPruneInProgress)
+	}
+	// Confirmado tras elegir las raíces: no se marca, pero no se puede borrar
+	fresh := commit(base.Copy(), 110, 120)
+	stats, err := db.prune([]common.Hash{kept})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deleted == 0 || db.HasState(dropped) {
+		t.Fatalf("state outside the roots was not pruned: %+v", stats)
+	}
+	for _, root := range []common.Hash{kept, fresh} {
+		state, err := OpenState(db, root)
+		if err != nil {
+			t.Fatalf("state %x: %v", root, err)
+		}
+		if err := state.UpdateMerkle(); err != nil || state.Root() != root {
+			t.Fatalf("state %x reopened with root %x (%v)", root, state.Root(), err)
+		}
+	}
+	// La poda terminó: la siguiente ya no protege nada
+	if stats, err := db.Prune([]common.Hash{kept}); err != nil || db.HasState(fresh) {
+		t.Fatalf("next prune: %+v, %v", stats, err)
+	}
+}
+
+// TestPruneConcurrentReads lee todos los estados de la cadena mientras esta
+// avanza y poda en cada bloque: cada lectura devuelve el estado entero o
+// ErrStateNotAvailable, nunca un estado a medio borrar.
+func TestPruneConcurrentReads(t *testing.T) {
+	const (
+		history = 2
+		blocks  = 20
+	)
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	genesis := &Genesis{
+		Config:   DefaultChainConfig(),
+		GasLimit: DefaultGasLimit,
+		Alloc:    GenesisAlloc{sender: {Balance: big.NewInt(1e18)}},
+	}
+	bc, err := NewBlockchain(storage.NewMemoryDB(), genesis, &CacheConfig{StateHistory: history, GCInterval: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewTxPool(bc, TxPoolConfig{})
+	defer pool.Stop()
+	producer := NewBlockProducer(bc, pool, DefaultProducerConfig)
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+		errc = make(chan error, 4)
+	)
+	for r := 0; r < cap(errc); r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for n := uint64(0); n <= bc.CurrentBlock().Header.BlockNumber; n++ {
+					block := bc.GetBlockByNumber(n)
+					state, err := bc.ReadStateAt(block.Hash())
+					if err != nil && !errors.Is(err, ErrStateNotAvailable) {
+						errc <- fmt.Errorf("state of block #%d: %w", n, err)
+						return
+					}
+					if err == nil && state.Root() != block.Header.StateRoot {
+						errc <- fmt.Errorf("state of block #%d: root %x, want %x", n, state.Root(), block.Header.StateRoot)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < blocks; i++ {
+		to := common.BigToAddress(big.NewInt(int64(1000 + i)))
+		addTx(t, pool, key, uint64(i), &to, nil)
+		if _, err := producer.ProduceBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+	// Una poda que sigue en marcha hace saltar las siguientes: sin barridos
+	// pendientes, la del último bloque se hace seguro
+	bc.pruneWG.Wait()
+	addTx(t, pool, key, blocks, &sender, nil)
+	if _, err := producer.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+	bc.pruneWG.Wait()
+	checkStates(t, bc, blocks+1-history, blocks+1, blocks/2)
+}
+
+// gatedDB detiene los iteradores de la base de datos mientras `gate` esté
+// abierto: el barrido de la poda se queda a medias hasta que se cierra.
+type gatedDB struct {
+	storage.KeyValueStore
+	gate chan struct{}
+}
+
+func (db *gatedDB) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	<-db.gate
+	return db.KeyValueStore.NewIterator(prefix, start)
+}
+
+// TestPruneInBackground comprueba que InsertBlock no espera al barrido: los
+// bloques se siguen importando mientras la poda está parada a medias, y Stop
+// espera a que termine.
+func TestPruneInBackground(t *testing.T) {
+	db := &gatedDB{KeyValueStore: storage.NewMemoryDB(), gate: make(chan struct{})}
+	bc, _, key := newTestChain(t, db)
+	bc.cacheConfig = &CacheConfig{StateHistory: 1, GCInterval: 2}
+
+	to := common.HexToAddress("0x1234")
+	parent := bc.Genesis()
+	for i := uint64(0); i < 5; i++ {
+		block := buildBlock(t, bc, parent, common.Address{}, newTestTx(t, key, i, &to, nil))
+		done := make(chan error, 1)
+		go func() { done <- bc.InsertBlock(block) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("InsertBlock #%d waited for the sweep", block.Header.BlockNumber)
+		}
+		parent = block
+	}
+	// La poda de #2 sigue parada y la de #4 no ha podido empezar
+	bc.statedb.mu.Lock()
+	pruning := bc.statedb.pruning
+	bc.statedb.mu.Unlock()
+	if !pruning || bc.lastGC != 2 {
+		t.Fatalf("sweep not in progress: pruning %v, last GC at #%d", pruning, bc.lastGC)
+	}
+
+	close(db.gate)
+	bc.Stop()
+	if bc.statedb.pruning {
+		t.Fatal("Stop returned before the sweep finished")
+	}
+	// La poda de #2 conserva #1 y #2 y lo que se escribió mientras barría
+	checkStates(t, bc, 1, 5, 0)
+}
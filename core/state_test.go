@@ -0,0 +1,264 @@
+// core/state_test.go
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// touchedPerBlock es cuántas cuentas cambia cada "bloque" en los benchmarks
+const touchedPerBlock = 100
+
+var benchmarkSizes = []int{1_000, 10_000, 100_000}
+
+func benchAddress(i int) common.Address {
+	return common.BigToAddress(uint256.NewInt(uint64(i) + 1).ToBig())
+}
+
+func newBenchState(accounts int) *State {
+	state := NewState()
+	stx := state.Begin()
+	for i := 0; i < accounts; i++ {
+		stx.SetBalance(benchAddress(i), uint256.NewInt(uint64(i)))
+		stx.SetNonce(benchAddress(i), 1)
+	}
+	stx.Commit()
+	return state
+}
+
+// BenchmarkUpdateMerkleIncremental mide el coste de la raíz tras un bloque que
+// cambia touchedPerBlock cuentas: debe crecer como log(cuentas), no linealmente.
+func BenchmarkUpdateMerkleIncremental(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("accounts=%d", size), func(b *testing.B) {
+			state := newBenchState(size)
+			state.UpdateMerkle()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stx := state.Begin()
+				for j := 0; j < touchedPerBlock; j++ {
+					stx.AddBalance(benchAddress((i*touchedPerBlock+j)%size), uint256.NewInt(1))
+				}
+				stx.Commit()
+				if err := state.UpdateMerkle(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUpdateMerkleFull mide la primera raíz de un estado, con todas las
+// cuentas sucias: es el coste de reconstruir la trie entera.
+func BenchmarkUpdateMerkleFull(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("accounts=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				state := newBenchState(size)
+				b.StartTimer()
+				if err := state.UpdateMerkle(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// rebuildState construye desde cero, en una base de datos nueva, un estado con
+// las mismas cuentas, código y storage que `s`.
+func rebuildState(t *testing.T, s *State) *State {
+	t.Helper()
+	fresh := NewState()
+	stx := fresh.Begin()
+	s.mu.RLock()
+	s.accounts.forEach(func(addr common.Address, acc *Account) {
+		stx.SetBalance(addr, acc.Balance)
+		stx.SetNonce(addr, acc.Nonce)
+		code, _ := s.code.get(acc.CodeHash)
+		stx.SetCode(addr, code)
+	})
+	s.storage.forEach(func(addr common.Address, slots *cowMap[common.Hash, common.Hash]) {
+		slots.forEach(func(slot, value common.Hash) {
+			stx.SetState(addr, slot, value)
+		})
+	})
+	s.mu.RUnlock()
+	stx.Commit()
+	if err := fresh.UpdateMerkle(); err != nil {
+		t.Fatal(err)
+	}
+	return fresh
+}
+
+// checkRoot comprueba que la raíz incremental de `s` es la de reconstruirlo.
+func checkRoot(t *testing.T, s *State, step string) {
+	t.Helper()
+	if err := s.UpdateMerkle(); err != nil {
+		t.Fatalf("%s: %v", step, err)
+	}
+	if have, want := s.Root(), rebuildState(t, s).Root(); have != want {
+		t.Fatalf("%s: incremental root %x, rebuilt root %x", step, have, want)
+	}
+}
+
+func slotKey(i int) common.Hash {
+	return common.BigToHash(uint256.NewInt(uint64(i)).ToBig())
+}
+
+func TestStateIncrementalRoot(t *testing.T) {
+	const accounts, contracts, slots = 50, 5, 20
+	code := []byte{0x60, 0x00, 0x35, 0x60, 0x00, 0x55}
+	state := NewState()
+	stx := state.Begin()
+	for i := 0; i < accounts; i++ {
+		stx.SetBalance(benchAddress(i), uint256.NewInt(uint64(i+1)))
+		stx.SetNonce(benchAddress(i), uint64(i))
+	}
+	for c := 0; c < contracts; c++ {
+		stx.SetCode(benchAddress(c), code)
+		for i := 0; i < slots; i++ {
+			stx.SetState(benchAddress(c), slotKey(i), common.BigToHash(uint256.NewInt(uint64(c*100+i+1)).ToBig()))
+		}
+	}
+	stx.Commit()
+	checkRoot(t, state, "initial")
+	// Tras el Commit las tries se reabren de disco
+	if _, err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	stx = state.Begin()
+	for i := 0; i < accounts; i += 3 {
+		stx.AddBalance(benchAddress(i), uint256.NewInt(7))
+		stx.IncrementNonce(benchAddress(i))
+	}
+	stx.SetState(benchAddress(0), slotKey(1), common.HexToHash("0xff"))
+	stx.SetState(benchAddress(0), slotKey(slots+1), common.HexToHash("0x01"))
+	stx.Commit()
+	checkRoot(t, state, "updates")
+
+	// Vaciar slots, uno a uno hasta dejar un contrato sin storage
+	stx = state.Begin()
+	stx.SetState(benchAddress(0), slotKey(2), common.Hash{})
+	for i := 0; i < slots; i++ {
+		stx.SetState(benchAddress(1), slotKey(i), common.Hash{})
+	}
+	stx.Commit()
+	checkRoot(t, state, "storage clears")
+	if root, err := state.GetStorageRoot(benchAddress(1)); err != nil || root != types.EmptyRootHash {
+		t.Fatalf("cleared storage root: %x (%v)", root, err)
+	}
+
+	// Borrar cuentas, con y sin storage, y volver a crear una
+	stx = state.Begin()
+	stx.DeleteAccount(benchAddress(2))
+	stx.DeleteAccount(benchAddress(accounts - 1))
+	stx.DeleteAccount(benchAddress(3))
+	stx.SetBalance(benchAddress(3), uint256.NewInt(1))
+	stx.Commit()
+	checkRoot(t, state, "deletes")
+	if state.GetState(benchAddress(3), slotKey(0)) != (common.Hash{}) {
+		t.Fatal("recreated account kept its old storage")
+	}
+
+	// Lo mismo sobre una copia, sin pasar por disco
+	cpy := state.Copy()
+	stx = cpy.Begin()
+	stx.DeleteAccount(benchAddress(4))
+	stx.SetState(benchAddress(0), slotKey(3), common.Hash{})
+	stx.AddBalance(benchAddress(10), uint256.NewInt(1))
+	stx.Commit()
+	checkRoot(t, cpy, "copy")
+	checkRoot(t, state, "original after copy")
+	if cpy.Root() == state.Root() {
+		t.Fatal("changes to the copy did not change its root")
+	}
+}
+
+// TestStateCopyOnWrite comprueba que una copia y su original no se ven los
+// cambios en ningún sentido, también al deshacer un StateTx y tras muchas
+// copias encadenadas (que funden las capas de los cowMaps).
+func TestStateCopyOnWrite(t *testing.T) {
+	a, b := benchAddress(0), benchAddress(1)
+	state := NewState()
+	stx := state.Begin()
+	stx.SetBalance(a, uint256.NewInt(100))
+	stx.SetState(a, slotKey(0), common.HexToHash("0x01"))
+	stx.Commit()
+	checkRoot(t, state, "initial")
+	root := state.Root()
+
+	cpy := state.Copy()
+	stx = cpy.Begin()
+	stx.SetBalance(a, uint256.NewInt(1))
+	stx.SetNonce(a, 5)
+	stx.SetState(a, slotKey(0), common.HexToHash("0x02"))
+	stx.SetState(b, slotKey(0), common.HexToHash("0x03"))
+	stx.Commit()
+	checkRoot(t, cpy, "copy")
+	if state.GetBalance(a).Uint64() != 100 || state.GetNonce(a) != 0 ||
+		state.GetState(a, slotKey(0)) != common.HexToHash("0x01") || state.Exists(b) {
+		t.Fatal("changes to the copy leaked into the original")
+	}
+	if checkRoot(t, state, "original"); state.Root() != root {
+		t.Fatalf("original root changed: %x, want %x", state.Root(), root)
+	}
+
+	// El original cambia después de la copia
+	stx = state.Begin()
+	stx.SetState(a, slotKey(0), common.HexToHash("0x09"))
+	stx.Commit()
+	if cpy.GetState(a, slotKey(0)) != common.HexToHash("0x02") {
+		t.Fatal("changes to the original leaked into the copy")
+	}
+
+	// Borrar y deshacer sobre valores compartidos
+	shared := state.Copy()
+	stx = state.Begin()
+	stx.DeleteAccount(a)
+	stx.Discard()
+	stx = state.Begin()
+	stx.SetState(a, slotKey(0), common.HexToHash("0x0a"))
+	stx.AddBalance(a, uint256.NewInt(1))
+	stx.Commit()
+	if shared.GetState(a, slotKey(0)) != common.HexToHash("0x09") || shared.GetBalance(a).Uint64() != 100 {
+		t.Fatal("reverted delete let later writes reach a shared copy")
+	}
+	checkRoot(t, state, "after reverted delete")
+	checkRoot(t, shared, "shared copy")
+
+	// Una cadena de copias, como la de los bloques
+	head := state
+	var (
+		history []*State
+		roots   []common.Hash
+	)
+	for i := 0; i < 200; i++ {
+		next := head.Copy()
+		stx := next.Begin()
+		stx.AddBalance(benchAddress(i%17), uint256.NewInt(1))
+		stx.SetState(a, slotKey(i%13), common.BigToHash(uint256.NewInt(uint64(i+1)).ToBig()))
+		if i%29 == 0 {
+			stx.DeleteAccount(benchAddress(i % 17))
+		}
+		stx.Commit()
+		if err := next.UpdateMerkle(); err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, next)
+		roots = append(roots, next.Root())
+		head = next
+	}
+	// Ninguna copia posterior cambió el contenido de las anteriores
+	for i, s := range history {
+		if root := rebuildState(t, s).Root(); root != roots[i] {
+			t.Fatalf("copy #%d: content root %x, want %x", i, root, roots[i])
+		}
+	}
+	checkRoot(t, head, "last copy")
+}
@@ -0,0 +1,184 @@
+// core/state_transition.go
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+var (
+	ErrIntrinsicGas      = errors.New("intrinsic gas too low")
+	ErrGasLimitReached   = errors.New("gas limit reached")
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+	ErrFeeCapTooLow      = errors.New("max fee per gas less than block base fee")
+	ErrTipAboveFeeCap    = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrSenderNoEOA       = errors.New("sender not an eoa")
+
+	ErrMaxInitCodeSizeExceeded = errors.New("max initcode size exceeded")
+)
+
+// ApplyTransaction ejecuta `tx` con la EVM sobre `state` dentro del bloque `header`.
+// Si la TX no tiene destinatario despliega `Data` como initcode de un contrato;
+// si lo tiene, llama al código del destinatario (o solo transfiere si no tiene).
+//
+// Hay dos clases de error con semánticas distintas:
+//   - Errores de consenso (nonce incorrecto, gas intrínseco, gas del bloque,
+//     precio, fondos, initcode demasiado grande): la TX nunca puede ser válida
+//     en este punto y se devuelve el error sin tocar el estado; no puede entrar
+//     en el bloque.
+//   - Errores de ejecución (sin gas, revert, opcode inválido...): la TX se
+//     incluye con un recibo de estado 0, consume su nonce y paga el gas usado,
+//     pero los efectos de la ejecución se deshacen.
+//
+// Se cobra gasUsed*effectiveGasPrice al emisor, se quema la parte de la base fee
+// y el Coinbase solo recibe la propina. `usedGas` acumula el gas del bloque.
+// No recalcula la raíz Merkle, eso se hace una vez por bloque.
+//
+// Todos los cambios se hacen en un StateTx: si se devuelve un error se
+// descartan y `state` queda como estaba.
+func ApplyTransaction(config *ChainConfig, chain ChainContext, state *State, header *BlockHeader, from common.Address, tx *RawTx, usedGas *uint64) (*Receipt, error) {
+	stx := state.Begin()
+	defer stx.Discard() // no hace nada tras el Commit
+
+	// 1. Validar nonce y que el emisor no sea un contrato (EIP-3607)
+	currentNonce := stx.GetNonce(from)
+	if tx.Nonce != currentNonce {
+		return nil, fmt.Errorf("invalid nonce: got %d, expected %d", tx.Nonce, currentNonce)
+	}
+	if len(stx.GetCode(from)) > 0 {
+		return nil, fmt.Errorf("%w: address %s", ErrSenderNoEOA, from.Hex())
+	}
+
+	// 2. Validar gas: la TX debe cubrir su gas intrínseco y caber en el bloque
+	if tx.IsCreate() && len(tx.Data) > MaxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %d limit %d", ErrMaxInitCodeSizeExceeded, len(tx.Data), MaxInitCodeSize)
+	}
+	intrinsicGas := IntrinsicGas(tx.Data, tx.AccessList, tx.IsCreate())
+	if tx.Gas() < intrinsicGas {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.Gas(), intrinsicGas)
+	}
+	if *usedGas+tx.Gas() > header.GasLimit {
+		return nil, fmt.Errorf("%w: block has %d left, tx wants %d", ErrGasLimitReached, header.GasLimit-*usedGas, tx.Gas())
+	}
+
+	// 3. Validar precio: el fee cap debe cubrir la base fee del bloque
+	if tx.GasTipCapValue().Cmp(tx.GasFeeCapValue()) > 0 {
+		return nil, fmt.Errorf("%w: tip %s, fee cap %s", ErrTipAboveFeeCap, tx.GasTipCapValue(), tx.GasFeeCapValue())
+	}
+	if tx.GasFeeCapValue().Cmp(bigOrZero(header.BaseFee)) < 0 {
+		return nil, fmt.Errorf("%w: fee cap %s, base fee %s", ErrFeeCapTooLow, tx.GasFeeCapValue(), header.BaseFee)
+	}
+
+	// 4. Validar balance: debe alcanzar para el gas máximo al precio máximo más el valor
+	balance := stx.GetBalance(from)
+	maxCost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCapValue())
+	maxCost.Add(maxCost, bigOrZero(tx.Value))
+	if balance.ToBig().Cmp(maxCost) < 0 {
+		return nil, fmt.Errorf("%w: address %s have %s want %s", ErrInsufficientFunds, from.Hex(), balance, maxCost)
+	}
+
+	// A partir de aquí la TX entra en el bloque pase lo que pase.
+	// 5. Comprar el gas al precio efectivo
+	gasPrice := tx.EffectiveGasPrice(header.BaseFee)
+	// Cabe en 256 bits: es menor que maxCost, que es menor que el balance
+	gasCost := uint256.MustFromBig(new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), gasPrice))
+	stx.SubBalance(from, gasCost)
+
+	// 6. Ejecutar en la EVM. Create incrementa él mismo el nonce del emisor;
+	// en una llamada lo hacemos nosotros. Si la ejecución falla la EVM deshace
+	// sus cambios (y consume todo el gas salvo en un REVERT)
+	statedb := NewStateDB(stx)
+	statedb.SetTxContext(tx.Hash())
+	blockCtx := NewEVMBlockContext(header, chain)
+	evm := vm.NewEVM(blockCtx, vm.TxContext{Origin: from, GasPrice: gasPrice}, statedb, config.EVMConfig(), vm.Config{})
+	rules := evm.ChainConfig().Rules(blockCtx.BlockNumber, blockCtx.Random != nil, blockCtx.Time)
+	statedb.Prepare(rules, from, header.Coinbase, tx.To, vm.ActivePrecompiles(rules), tx.AccessList)
+
+	value := uint256.MustFromBig(bigOrZero(tx.Value))
+	gasLeft := tx.Gas() - intrinsicGas
+	var (
+		contractAddr common.Address
+		execErr      error
+	)
+	if tx.IsCreate() {
+		_, contractAddr, gasLeft, execErr = evm.Create(vm.AccountRef(from), tx.Data, gasLeft, value)
+	} else {
+		statedb.SetNonce(from, tx.Nonce+1)
+		_, gasLeft, execErr = evm.Call(vm.AccountRef(from), *tx.To, tx.Data, gasLeft, value)
+	}
+
+	// 7. Devolver al emisor el gas sobrante más el refund (como mucho gasUsed/5, EIP-3529)
+	refund := statedb.GetRefund()
+	if maxRefund := (tx.Gas() - gasLeft) / RefundQuotient; refund > maxRefund {
+		refund = maxRefund
+	}
+	gasLeft += refund
+	gasUsed := tx.Gas() - gasLeft
+	remaining := new(uint256.Int).Mul(uint256.NewInt(gasLeft), uint256.MustFromBig(gasPrice))
+	statedb.AddBalance(from, remaining, tracing.BalanceIncreaseGasReturn)
+
+	// 8. El proponente solo recibe la propina, gasUsed*baseFee se quema
+	tip := new(big.Int).Sub(gasPrice, bigOrZero(header.BaseFee))
+	tipFee := new(uint256.Int).Mul(uint256.NewInt(gasUsed), uint256.MustFromBig(tip))
+	statedb.AddBalance(header.Coinbase, tipFee, tracing.BalanceIncreaseRewardTransactionFee)
+	statedb.Finalise(true)
+	if err := statedb.Error(); err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	*usedGas += gasUsed
+	receipt := &Receipt{
+		Type:              tx.Type,
+		Status:            ReceiptStatusSuccessful,
+		CumulativeGasUsed: *usedGas,
+		Logs:              statedb.GetLogs(),
+		TxHash:            tx.Hash(),
+		From:              from,
+		GasUsed:           gasUsed,
+		EffectiveGasPrice: gasPrice,
+	}
+	if execErr != nil {
+		receipt.Status = ReceiptStatusFailed
+	}
+	if tx.IsCreate() {
+		receipt.ContractAddress = contractAddr
+	}
+	receipt.Bloom = types.BytesToBloom(types.LogsBloom(receipt.Logs))
+	stx.Commit()
+	return receipt, nil
+}
+
+// CallGasCap es el gas con el que se ejecuta una llamada de solo lectura.
+const CallGasCap = 50_000_000
+
+// Call ejecuta el código de `to` con `data` como lo haría una TX de `from`
+// dentro de `header` y devuelve lo que retorna, sin cobrar gas ni subir el
+// nonce. Es la base de eth_call. Se ejecuta sobre una copia que se descarta,
+// así que `state` puede ser un estado compartido.
+func Call(config *ChainConfig, chain ChainContext, state *State, header *BlockHeader, from, to common.Address, data []byte) ([]byte, error) {
+	stx := state.Copy().Begin()
+	defer stx.Discard()
+
+	statedb := NewStateDB(stx)
+	blockCtx := NewEVMBlockContext(header, chain)
+	// NoBaseFee: la llamada no paga gas, su precio 0 no tiene que cubrir la base fee
+	evm := vm.NewEVM(blockCtx, vm.TxContext{Origin: from, GasPrice: new(big.Int)}, statedb, config.EVMConfig(), vm.Config{NoBaseFee: true})
+	rules := evm.ChainConfig().Rules(blockCtx.BlockNumber, blockCtx.Random != nil, blockCtx.Time)
+	statedb.Prepare(rules, from, header.Coinbase, &to, vm.ActivePrecompiles(rules), nil)
+
+	ret, _, err := evm.Call(vm.AccountRef(from), to, data, CallGasCap, new(uint256.Int))
+	if stateErr := statedb.Error(); stateErr != nil {
+		return nil, fmt.Errorf("read state: %w", stateErr)
+	}
+	if err != nil {
+		return ret, fmt.Errorf("execution failed: %w", err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,206 @@
+// core/state_tx.go
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+var ErrStateTxClosed = errors.New("state transaction already committed or discarded")
+
+// StateTx es la única forma de modificar un State: agrupa cambios que se
+// aplican todos (Commit) o ninguno (Discard).
+//
+// Cada State admite un solo escritor: Begin espera a que el StateTx anterior
+// se cierre, y UpdateMerkle, Commit y Reset también esperan. Las lecturas no
+// se bloquean y ven los cambios del StateTx abierto a medida que se hacen, por
+// eso los estados compartidos (la cabeza, los de cada bloque) no se modifican
+// nunca con un StateTx: se ejecuta sobre una copia y se adopta con Reset.
+//
+//	stx := state.Begin()
+//	defer stx.Discard() // no hace nada si ya se hizo Commit
+//	...
+//	stx.Commit()
+type StateTx struct {
+	state *State
+	snap  int  // posición del journal al abrirlo
+	done  bool // ya se hizo Commit o Discard
+}
+
+// Begin abre un StateTx sobre el estado, esperando si hay otro abierto.
+func (s *State) Begin() *StateTx {
+	s.writer.Lock()
+	return &StateTx{state: s, snap: s.snapshot()}
+}
+
+// Commit mantiene los cambios y libera el estado para el siguiente escritor.
+// Los cambios quedan en el journal hasta el próximo UpdateMerkle.
+func (tx *StateTx) Commit() {
+	if tx.done {
+		panic(ErrStateTxClosed)
+	}
+	tx.done = true
+	tx.state.writer.Unlock()
+}
+
+// Discard deshace todos los cambios del StateTx y libera el estado. Después
+// de Commit no hace nada, así se puede usar con defer.
+func (tx *StateTx) Discard() {
+	if tx.done {
+		return
+	}
+	tx.state.revertToSnapshot(tx.snap)
+	tx.done = true
+	tx.state.writer.Unlock()
+}
+
+// lock toma s.mu para escribir. Falla si el StateTx ya está cerrado: sin el
+// escritor retenido otra goroutine podría estar modificando el estado.
+func (tx *StateTx) lock() *State {
+	if tx.done {
+		panic(ErrStateTxClosed)
+	}
+	tx.state.mu.Lock()
+	return tx.state
+}
+
+// Snapshot devuelve un identificador del punto actual dentro del StateTx
+// para volver a él con RevertToSnapshot (p.ej. una llamada de la EVM que revierte).
+func (tx *StateTx) Snapshot() int {
+	if tx.done {
+		panic(ErrStateTxClosed)
+	}
+	return tx.state.snapshot()
+}
+
+// RevertToSnapshot deshace los cambios posteriores al snapshot `id`, que debe
+// haberse tomado dentro de este StateTx.
+func (tx *StateTx) RevertToSnapshot(id int) {
+	if tx.done {
+		panic(ErrStateTxClosed)
+	}
+	if id < tx.snap {
+		panic(fmt.Sprintf("state snapshot %d was taken before the transaction began (%d)", id, tx.snap))
+	}
+	tx.state.revertToSnapshot(id)
+}
+
+// --- Lecturas: ven los cambios ya hechos en el StateTx ---
+
+func (tx *StateTx) GetNonce(address common.Address) uint64 {
+	return tx.state.GetNonce(address)
+}
+
+func (tx *StateTx) GetBalance(address common.Address) *uint256.Int {
+	return tx.state.GetBalance(address)
+}
+
+func (tx *StateTx) GetCode(address common.Address) []byte {
+	return tx.state.GetCode(address)
+}
+
+func (tx *StateTx) GetCodeHash(address common.Address) common.Hash {
+	return tx.state.GetCodeHash(address)
+}
+
+func (tx *StateTx) GetState(address common.Address, key common.Hash) common.Hash {
+	return tx.state.GetState(address, key)
+}
+
+func (tx *StateTx) GetStorageRoot(address common.Address) (common.Hash, error) {
+	return tx.state.GetStorageRoot(address)
+}
+
+func (tx *StateTx) Exists(address common.Address) bool {
+	return tx.state.Exists(address)
+}
+
+// --- Escrituras ---
+
+// SetNonce fija el nonce de una dirección
+func (tx *StateTx) SetNonce(address common.Address, nonce uint64) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	s.setNonce(address, nonce)
+}
+
+// IncrementNonce suma uno al nonce de una dirección
+func (tx *StateTx) IncrementNonce(address common.Address) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	s.setNonce(address, s.getOrNewAccount(address).Nonce+1)
+}
+
+// SetBalance establece un balance para una dirección
+func (tx *StateTx) SetBalance(address common.Address, amount *uint256.Int) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	s.setBalance(address, new(uint256.Int).Set(amount))
+}
+
+// AddBalance suma `amount` al balance de una dirección
+func (tx *StateTx) AddBalance(address common.Address, amount *uint256.Int) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	acc := s.getOrNewAccount(address)
+	s.setBalance(address, new(uint256.Int).Add(acc.Balance, amount))
+}
+
+// SubBalance resta `amount` del balance de una dirección. El llamador debe
+// comprobar antes que hay fondos suficientes.
+func (tx *StateTx) SubBalance(address common.Address, amount *uint256.Int) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	acc := s.getOrNewAccount(address)
+	s.setBalance(address, new(uint256.Int).Sub(acc.Balance, amount))
+}
+
+// SetCode guarda el bytecode de una dirección. El código se almacena una sola
+// vez por hash aunque lo compartan varios contratos.
+func (tx *StateTx) SetCode(address common.Address, code []byte) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	acc := s.getOrNewAccount(address)
+	s.journal = append(s.journal, codeChange{address: address, prevHash: acc.CodeHash})
+	if len(code) == 0 {
+		acc.CodeHash = types.EmptyCodeHash
+		return
+	}
+	acc.CodeHash = crypto.Keccak256Hash(code)
+	s.code.set(acc.CodeHash, code)
+}
+
+// SetState escribe un slot de storage; escribir cero borra el slot
+func (tx *StateTx) SetState(address common.Address, key, value common.Hash) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	s.getOrNewAccount(address)
+	s.journal = append(s.journal, storageChange{address: address, slot: key, prev: s.getState(address, key)})
+	s.setStorage(address, key, value)
+}
+
+// DeleteAccount borra la cuenta y su storage. El código se queda porque
+// puede compartirlo otro contrato.
+func (tx *StateTx) DeleteAccount(address common.Address) {
+	s := tx.lock()
+	defer s.mu.Unlock()
+	storage, _ := s.storage.get(address)
+	storageTrie, _ := s.storageTries.get(address)
+	s.journal = append(s.journal, deleteAccountChange{
+		address:     address,
+		prev:        s.account(address),
+		storage:     storage,
+		storageTrie: storageTrie,
+		dirtySlots:  s.dirtySlots[address],
+	})
+	s.accounts.delete(address)
+	s.storage.delete(address)
+	s.storageTries.delete(address)
+	delete(s.dirtySlots, address)
+	s.dirty[address] = struct{}{}
+}
@@ -0,0 +1,125 @@
+// core/state_tx_test.go
+package core
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+func TestStateTxCommitAndDiscard(t *testing.T) {
+	state := NewState()
+	a, b := benchAddress(0), benchAddress(1)
+
+	stx := state.Begin()
+	stx.SetBalance(a, uint256.NewInt(100))
+	stx.Commit()
+
+	stx = state.Begin()
+	stx.SubBalance(a, uint256.NewInt(40))
+	stx.AddBalance(b, uint256.NewInt(40))
+	stx.IncrementNonce(a)
+	stx.Discard()
+	if got := state.GetBalance(a).Uint64(); got != 100 {
+		t.Fatalf("balance of a after discard: have %d, want 100", got)
+	}
+	if state.Exists(b) || state.GetNonce(a) != 0 {
+		t.Fatal("discarded transaction left changes behind")
+	}
+
+	if !Transfer(state, a, b, uint256.NewInt(60)) {
+		t.Fatal("transfer with enough funds failed")
+	}
+	if Transfer(state, a, b, uint256.NewInt(60)) {
+		t.Fatal("transfer without funds succeeded")
+	}
+	if state.GetBalance(a).Uint64() != 40 || state.GetBalance(b).Uint64() != 60 {
+		t.Fatalf("unexpected balances %s %s", state.GetBalance(a), state.GetBalance(b))
+	}
+}
+
+func TestStateTxClosed(t *testing.T) {
+	stx := NewState().Begin()
+	stx.Commit()
+	stx.Discard() // tras Commit no hace nada
+	defer func() {
+		if recover() == nil {
+			t.Fatal("write after commit did not panic")
+		}
+	}()
+	stx.SetNonce(benchAddress(0), 1)
+}
+
+// TestStateTxConcurrent lanza escritores, lectores y UpdateMerkle a la vez
+// sobre el mismo estado. Con un solo escritor ningún Transfer puede gastar
+// fondos que otro ya gastó, así que el total se conserva y ningún balance
+// pasa por debajo de cero. Se ejecuta con -race.
+func TestStateTxConcurrent(t *testing.T) {
+	const (
+		accounts  = 8
+		writers   = 8
+		transfers = 200
+		initial   = 1000
+	)
+	state := NewState()
+	stx := state.Begin()
+	for i := 0; i < accounts; i++ {
+		stx.SetBalance(benchAddress(i), uint256.NewInt(initial))
+	}
+	stx.Commit()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				from, to := benchAddress((w+i)%accounts), benchAddress((w+i+1)%accounts)
+				Transfer(state, from, to, uint256.NewInt(uint64(i%300)))
+				if i%50 == 0 {
+					if err := state.UpdateMerkle(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				addr := benchAddress(r % accounts)
+				state.GetBalance(addr)
+				state.GetAccount(addr)
+				state.GetProof(addr) // puede fallar con ErrStateNotHashed, da igual
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	total := new(uint256.Int)
+	for i := 0; i < accounts; i++ {
+		total.Add(total, state.GetBalance(benchAddress(i)))
+	}
+	if total.Uint64() != accounts*initial {
+		t.Fatalf("total balance changed: have %d, want %d", total.Uint64(), accounts*initial)
+	}
+	if err := state.UpdateMerkle(); err != nil {
+		t.Fatal(err)
+	}
+	if root := state.Root(); root != state.Copy().Root() {
+		t.Fatalf("copy has a different root")
+	}
+}
@@ -0,0 +1,390 @@
+// core/statedb.go
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/stateless"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie/utils"
+	"github.com/holiman/uint256"
+)
+
+// StateDB adapta State a la interfaz vm.StateDB de go-ethereum para poder
+// ejecutar contratos con su EVM. Los cambios se escriben en el StateTx de la
+// transacción, que los apunta en el journal de State; así
+// Snapshot/RevertToSnapshot pueden descartar una llamada que revierte sin
+// tocar el resto de la TX.
+//
+// Lo que solo vive durante una transacción (refunds, logs, access list,
+// transient storage, cuentas destruidas) se guarda aquí, con su propio journal,
+// y se limpia en Finalise.
+type StateDB struct {
+	state *StateTx
+
+	journal   []func()                    // acciones para deshacer los cambios de la TX, en orden
+	revisions []revision                  // snapshots abiertos, el id es su posición
+	dirties   map[common.Address]struct{} // cuentas tocadas en la TX actual
+
+	thash  common.Hash
+	logs   []*types.Log
+	refund uint64
+
+	originStorage  map[common.Address]map[common.Hash]common.Hash // valor de cada slot al empezar la TX
+	transient      map[common.Address]map[common.Hash]common.Hash // EIP-1153
+	accessList     map[common.Address]map[common.Hash]struct{}    // EIP-2929
+	newContracts   map[common.Address]struct{}                    // creados en esta TX (EIP-6780)
+	selfDestructed map[common.Address]struct{}
+
+	dbErr error // primer error al leer el estado; la interfaz de la EVM no los devuelve
+}
+
+// revision es un snapshot de StateDB: la posición de su journal y el
+// snapshot de State tomado a la vez.
+type revision struct {
+	journal int
+	state   int
+}
+
+// NewStateDB envuelve el StateTx `state` para ejecutarlo con la EVM.
+func NewStateDB(state *StateTx) *StateDB {
+	return &StateDB{
+		state:          state,
+		dirties:        make(map[common.Address]struct{}),
+		originStorage:  make(map[common.Address]map[common.Hash]common.Hash),
+		transient:      make(map[common.Address]map[common.Hash]common.Hash),
+		accessList:     make(map[common.Address]map[common.Hash]struct{}),
+		newContracts:   make(map[common.Address]struct{}),
+		selfDestructed: make(map[common.Address]struct{}),
+	}
+}
+
+// SetTxContext fija la TX que se está ejecutando, para etiquetar sus logs.
+// El resto de campos de los logs se rellenan al guardar el bloque (DeriveFields).
+func (s *StateDB) SetTxContext(thash common.Hash) {
+	s.thash = thash
+}
+
+// GetLogs devuelve los logs emitidos por la TX actual.
+func (s *StateDB) GetLogs() []*types.Log {
+	if s.logs == nil {
+		return []*types.Log{}
+	}
+	return s.logs
+}
+
+func (s *StateDB) touch(addr common.Address) {
+	s.dirties[addr] = struct{}{}
+}
+
+// --- Cuentas ---
+
+func (s *StateDB) CreateAccount(addr common.Address) {
+	if s.state.Exists(addr) {
+		return
+	}
+	s.touch(addr)
+	s.state.SetBalance(addr, new(uint256.Int))
+}
+
+func (s *StateDB) CreateContract(addr common.Address) {
+	if _, ok := s.newContracts[addr]; ok {
+		return
+	}
+	s.newContracts[addr] = struct{}{}
+	s.journal = append(s.journal, func() { delete(s.newContracts, addr) })
+}
+
+func (s *StateDB) Exist(addr common.Address) bool {
+	if _, ok := s.selfDestructed[addr]; ok {
+		return true
+	}
+	return s.state.Exists(addr)
+}
+
+func (s *StateDB) Empty(addr common.Address) bool {
+	return s.state.GetBalance(addr).IsZero() && s.state.GetNonce(addr) == 0 && len(s.state.GetCode(addr)) == 0
+}
+
+// --- Balance y nonce ---
+
+func (s *StateDB) GetBalance(addr common.Address) *uint256.Int {
+	return s.state.GetBalance(addr)
+}
+
+func (s *StateDB) setBalance(addr common.Address, amount *uint256.Int) {
+	s.touch(addr)
+	s.state.SetBalance(addr, amount)
+}
+
+func (s *StateDB) AddBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) uint256.Int {
+	prev := s.state.GetBalance(addr)
+	s.setBalance(addr, new(uint256.Int).Add(prev, amount))
+	return *prev
+}
+
+func (s *StateDB) SubBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) uint256.Int {
+	prev := s.state.GetBalance(addr)
+	s.setBalance(addr, new(uint256.Int).Sub(prev, amount))
+	return *prev
+}
+
+func (s *StateDB) GetNonce(addr common.Address) uint64 {
+	return s.state.GetNonce(addr)
+}
+
+func (s *StateDB) SetNonce(addr common.Address, nonce uint64) {
+	s.touch(addr)
+	s.state.SetNonce(addr, nonce)
+}
+
+// --- Código ---
+
+func (s *StateDB) GetCode(addr common.Address) []byte {
+	return s.state.GetCode(addr)
+}
+
+func (s *StateDB) GetCodeSize(addr common.Address) int {
+	return len(s.state.GetCode(addr))
+}
+
+func (s *StateDB) GetCodeHash(addr common.Address) common.Hash {
+	if !s.Exist(addr) {
+		return common.Hash{}
+	}
+	return s.state.GetCodeHash(addr)
+}
+
+func (s *StateDB) SetCode(addr common.Address, code []byte) {
+	s.touch(addr)
+	s.state.SetCode(addr, code)
+}
+
+// --- Storage ---
+
+func (s *StateDB) GetState(addr common.Address, slot common.Hash) common.Hash {
+	return s.state.GetState(addr, slot)
+}
+
+// GetCommittedState devuelve el valor del slot al empezar la TX (para el gas de SSTORE).
+func (s *StateDB) GetCommittedState(addr common.Address, slot common.Hash) common.Hash {
+	if value, ok := s.originStorage[addr][slot]; ok {
+		return value
+	}
+	return s.state.GetState(addr, slot)
+}
+
+func (s *StateDB) SetState(addr common.Address, slot, value common.Hash) common.Hash {
+	prev := s.state.GetState(addr, slot)
+	if prev == value {
+		return prev
+	}
+	if s.originStorage[addr] == nil {
+		s.originStorage[addr] = make(map[common.Hash]common.Hash)
+	}
+	if _, ok := s.originStorage[addr][slot]; !ok {
+		s.originStorage[addr][slot] = prev
+	}
+	s.touch(addr)
+	s.state.SetState(addr, slot, value)
+	return prev
+}
+
+func (s *StateDB) GetStorageRoot(addr common.Address) common.Hash {
+	root, err := s.state.GetStorageRoot(addr)
+	if err != nil && s.dbErr == nil {
+		s.dbErr = err
+	}
+	return root
+}
+
+// Error devuelve el primer error de lectura del estado durante la ejecución,
+// como StateDB.Error en geth: si no es nil el resultado no es fiable.
+func (s *StateDB) Error() error {
+	return s.dbErr
+}
+
+func (s *StateDB) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transient[addr][key]
+}
+
+func (s *StateDB) SetTransientState(addr common.Address, key, value common.Hash) {
+	prev := s.transient[addr][key]
+	if prev == value {
+		return
+	}
+	s.setTransient(addr, key, value)
+	s.journal = append(s.journal, func() { s.setTransient(addr, key, prev) })
+}
+
+func (s *StateDB) setTransient(addr common.Address, key, value common.Hash) {
+	if s.transient[addr] == nil {
+		s.transient[addr] = make(map[common.Hash]common.Hash)
+	}
+	s.transient[addr][key] = value
+}
+
+// --- Refunds ---
+
+func (s *StateDB) AddRefund(gas uint64) {
+	prev := s.refund
+	s.refund += gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *StateDB) SubRefund(gas uint64) {
+	if gas > s.refund {
+		panic("refund counter below zero")
+	}
+	prev := s.refund
+	s.refund -= gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
+// --- Selfdestruct ---
+
+func (s *StateDB) SelfDestruct(addr common.Address) uint256.Int {
+	if !s.Exist(addr) {
+		return uint256.Int{}
+	}
+	prev := s.GetBalance(addr)
+	if !prev.IsZero() {
+		s.setBalance(addr, new(uint256.Int))
+	}
+	if _, ok := s.selfDestructed[addr]; !ok {
+		s.touch(addr)
+		s.selfDestructed[addr] = struct{}{}
+		s.journal = append(s.journal, func() { delete(s.selfDestructed, addr) })
+	}
+	return *prev
+}
+
+// SelfDestruct6780 solo destruye el contrato si se creó en esta misma TX (EIP-6780).
+func (s *StateDB) SelfDestruct6780(addr common.Address) (uint256.Int, bool) {
+	if _, ok := s.newContracts[addr]; ok {
+		return s.SelfDestruct(addr), true
+	}
+	return *s.GetBalance(addr), false
+}
+
+func (s *StateDB) HasSelfDestructed(addr common.Address) bool {
+	_, ok := s.selfDestructed[addr]
+	return ok
+}
+
+// --- Access list (EIP-2929) ---
+
+func (s *StateDB) AddressInAccessList(addr common.Address) bool {
+	_, ok := s.accessList[addr]
+	return ok
+}
+
+func (s *StateDB) SlotInAccessList(addr common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, addressOk := s.accessList[addr]
+	if !addressOk {
+		return false, false
+	}
+	_, slotOk = slots[slot]
+	return addressOk, slotOk
+}
+
+func (s *StateDB) AddAddressToAccessList(addr common.Address) {
+	if _, ok := s.accessList[addr]; ok {
+		return
+	}
+	s.accessList[addr] = make(map[common.Hash]struct{})
+	s.journal = append(s.journal, func() { delete(s.accessList, addr) })
+}
+
+func (s *StateDB) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	s.AddAddressToAccessList(addr)
+	if _, ok := s.accessList[addr][slot]; ok {
+		return
+	}
+	s.accessList[addr][slot] = struct{}{}
+	s.journal = append(s.journal, func() { delete(s.accessList[addr], slot) })
+}
+
+// Prepare prepara el access list y el transient storage antes de ejecutar una TX.
+func (s *StateDB) Prepare(rules params.Rules, sender, coinbase common.Address, dst *common.Address, precompiles []common.Address, list types.AccessList) {
+	if rules.IsBerlin {
+		s.accessList = make(map[common.Address]map[common.Hash]struct{})
+		s.AddAddressToAccessList(sender)
+		if dst != nil {
+			s.AddAddressToAccessList(*dst)
+		}
+		for _, addr := range precompiles {
+			s.AddAddressToAccessList(addr)
+		}
+		for _, el := range list {
+			s.AddAddressToAccessList(el.Address)
+			for _, key := range el.StorageKeys {
+				s.AddSlotToAccessList(el.Address, key)
+			}
+		}
+		if rules.IsShanghai { // EIP-3651: coinbase caliente
+			s.AddAddressToAccessList(coinbase)
+		}
+	}
+	s.transient = make(map[common.Address]map[common.Hash]common.Hash)
+}
+
+// --- Logs ---
+
+func (s *StateDB) AddLog(log *types.Log) {
+	log.TxHash = s.thash
+	s.logs = append(s.logs, log)
+	s.journal = append(s.journal, func() { s.logs = s.logs[:len(s.logs)-1] })
+}
+
+// AddPreimage no se usa: no guardamos preimágenes de sha3.
+func (s *StateDB) AddPreimage(common.Hash, []byte) {}
+
+// --- Snapshots ---
+
+// Snapshot devuelve un identificador del punto actual, tanto del estado como
+// de los datos de la TX.
+func (s *StateDB) Snapshot() int {
+	s.revisions = append(s.revisions, revision{journal: len(s.journal), state: s.state.Snapshot()})
+	return len(s.revisions) - 1
+}
+
+// RevertToSnapshot deshace, en orden inverso, todos los cambios posteriores al
+// snapshot; los snapshots tomados después dejan de ser válidos.
+func (s *StateDB) RevertToSnapshot(id int) {
+	rev := s.revisions[id]
+	for i := len(s.journal) - 1; i >= rev.journal; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:rev.journal]
+	s.state.RevertToSnapshot(rev.state)
+	s.revisions = s.revisions[:id]
+}
+
+// Finalise cierra la TX: borra las cuentas destruidas y, si `deleteEmptyObjects`
+// (EIP-158), las tocadas que quedaron vacías. Después limpia el journal y el
+// estado temporal de la TX.
+func (s *StateDB) Finalise(deleteEmptyObjects bool) {
+	for addr := range s.dirties {
+		if _, destructed := s.selfDestructed[addr]; destructed || (deleteEmptyObjects && s.Empty(addr)) {
+			s.state.DeleteAccount(addr)
+		}
+	}
+	s.journal = nil
+	s.revisions = nil
+	s.refund = 0
+	s.dirties = make(map[common.Address]struct{})
+	s.originStorage = make(map[common.Address]map[common.Hash]common.Hash)
+	s.newContracts = make(map[common.Address]struct{})
+	s.selfDestructed = make(map[common.Address]struct{})
+}
+
+// PointCache y Witness solo se usan con Verkle trees, que no soportamos.
+func (s *StateDB) PointCache() *utils.PointCache { return nil }
+
+func (s *StateDB) Witness() *stateless.Witness { return nil }
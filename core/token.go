@@ -1,13 +1,23 @@
 // core/token.go
 package core
 
-// Aquí definimos funciones de transferencia e inicialización de balances
-func Transfer(balanceMap map[string]uint64, from, to string, amount uint64) bool {
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// Aquí definimos funciones de transferencia e inicialización de balances.
+// La comprobación de saldo y el movimiento van en el mismo StateTx, así otro
+// escritor no puede gastar los fondos entre medias.
+func Transfer(state *State, from, to common.Address, amount *uint256.Int) bool {
+	stx := state.Begin()
+	defer stx.Discard()
 	// Checar si `from` tiene saldo suficiente
-	if balanceMap[from] < amount {
+	if stx.GetBalance(from).Cmp(amount) < 0 {
 		return false
 	}
-	balanceMap[from] -= amount
-	balanceMap[to] += amount
+	stx.SubBalance(from, amount)
+	stx.AddBalance(to, amount)
+	stx.Commit()
 	return true
 }
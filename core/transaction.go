@@ -2,38 +2,109 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/pkg/errors"
-	"log"
 	"math/big"
+	"sync/atomic"
 	// go-ethereum libs (puedes reemplazarlas si prefieres otras)
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
-// Transaction representa una transacción simple.
+// RawTx representa una transacción de cualquiera de los tipos soportados
+// (legacy, EIP-2930 o EIP-1559). Los campos que no usa su tipo quedan a nil.
 type RawTx struct {
+	Type     uint8
+	ChainID  *big.Int // solo tipadas, las legacy lo llevan en V (EIP-155)
 	Nonce    uint64
-	GasPrice *big.Int
-	GasLimit *big.Int
-	To       common.Address
-	Value    *big.Int
-	Data     []byte
+	GasPrice *big.Int // legacy y access list
+	// EIP-1559: maxPriorityFeePerGas y maxFeePerGas
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	GasLimit   *big.Int
+	To         *common.Address // nil en las transacciones que crean un contrato
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList // EIP-2930 y EIP-1559
 
-	// Firma
+	// Firma (en las tipadas V es la paridad y, 0 o 1)
 	V *big.Int
 	R *big.Int
 	S *big.Int
+
+	from atomic.Pointer[common.Address] // emisor ya recuperado de la firma (ver From)
+}
+
+// Transactions es la lista de transacciones de un bloque.
+type Transactions []*RawTx
+
+// Len implementa types.DerivableList
+func (txs Transactions) Len() int { return len(txs) }
+
+// EncodeIndex implementa types.DerivableList con la codificación canónica de la transacción i.
+func (txs Transactions) EncodeIndex(i int, w *bytes.Buffer) {
+	enc, _ := txs[i].MarshalBinary()
+	w.Write(enc)
+}
+
+// Gas devuelve el gas límite de la transacción como uint64.
+func (tx *RawTx) Gas() uint64 {
+	if tx.GasLimit == nil || !tx.GasLimit.IsUint64() {
+		return 0
+	}
+	return tx.GasLimit.Uint64()
+}
+
+// GasFeeCapValue es lo máximo que la TX paga por unidad de gas.
+func (tx *RawTx) GasFeeCapValue() *big.Int {
+	if tx.Type == DynamicFeeTxType {
+		return bigOrZero(tx.GasFeeCap)
+	}
+	return bigOrZero(tx.GasPrice)
 }
 
-func (tx *RawTx) From() string {
-	// Lógica simplificada para obtener la dirección "From"
-	// En un escenario real se usaría la firma (V,R,S).
-	return "0xFromAddress0000000000000000000000000000000000"
+// GasTipCapValue es la propina máxima por unidad de gas para el proponente.
+func (tx *RawTx) GasTipCapValue() *big.Int {
+	if tx.Type == DynamicFeeTxType {
+		return bigOrZero(tx.GasTipCap)
+	}
+	return bigOrZero(tx.GasPrice)
+}
+
+// EffectiveGasPrice es el precio por gas que se cobra realmente:
+// min(gasFeeCap, baseFee + gasTipCap). Sin base fee se toma como cero.
+func (tx *RawTx) EffectiveGasPrice(baseFee *big.Int) *big.Int {
+	price := new(big.Int).Set(tx.GasTipCapValue())
+	if baseFee != nil {
+		price.Add(price, baseFee)
+	}
+	if feeCap := tx.GasFeeCapValue(); price.Cmp(feeCap) > 0 {
+		price.Set(feeCap)
+	}
+	return price
 }
 
+func bigOrZero(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return x
+}
+
+// ToAddr devuelve el destinatario, o la dirección cero si la TX crea un contrato.
 func (tx *RawTx) ToAddr() common.Address {
-	return tx.To
+	if tx.To == nil {
+		return common.Address{}
+	}
+	return *tx.To
+}
+
+// IsCreate indica si la transacción despliega un contrato (no tiene destinatario).
+func (tx *RawTx) IsCreate() bool {
+	return tx.To == nil
 }
 
 // DecodedTx es lo que usaremos tras decodificar la TX RLP y verificar la firma
@@ -45,105 +116,144 @@ type DecodedTx struct {
 	R, S, V *big.Int
 }
 
-// VerifySignature extrae la dirección `From` a partir de la firma (V,R,S)
-func (tx *RawTx) VerifySignature() (common.Address, error) {
-	// 1. Obtenemos el hash del "mensaje" a firmar (en Ethereum es la hash RLP + "Ethereum Signed Message" en caso de typed data, etc.)
-	//    Para simplificar, supongamos que la firma es la transacción misma RLP-hasheada.
-	//    En un escenario real, usarías algo como: sigHash = rlpHash(txWithoutSignature).
-	sigHash := RawTxHash(tx)
+var (
+	ErrInvalidSig     = errors.New("invalid transaction v, r, s values")
+	ErrInvalidChainId = errors.New("invalid chain id for signer")
+)
 
-	// 2. Reconstruimos la firma.
-	//    Normalmente en Ethereum la "V" = 27/28 (o con chainId). Restamos 27 si es mayor que 28.
-	v := tx.V.Uint64()
-	if v == 27 || v == 28 {
-		// OK
-	} else if v >= 35 {
-		// para EIP-155, etc., lo ignoramos en este ejemplo
-		v -= 35
+// SigningHash es el hash que firma el emisor, según el tipo de TX:
+//   - legacy con chainID (EIP-155): keccak(rlp(nonce, gasPrice, gas, to, value, data, chainId, 0, 0))
+//   - legacy con chainID nil: el hash pre-EIP-155, sin protección contra replay
+//   - 0x01: keccak(0x01 || rlp(chainId, nonce, gasPrice, gas, to, value, data, accessList))
+//   - 0x02: keccak(0x02 || rlp(chainId, nonce, tip, feeCap, gas, to, value, data, accessList))
+func (tx *RawTx) SigningHash(chainID *big.Int) common.Hash {
+	var fields []interface{}
+	switch tx.Type {
+	case AccessListTxType:
+		fields = []interface{}{chainID, tx.Nonce, tx.GasPrice, tx.GasLimit, tx.To, tx.Value, tx.Data, tx.AccessList}
+	case DynamicFeeTxType:
+		fields = []interface{}{chainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.GasLimit, tx.To, tx.Value, tx.Data, tx.AccessList}
+	default:
+		fields = []interface{}{tx.Nonce, tx.GasPrice, tx.GasLimit, tx.To, tx.Value, tx.Data}
+		if chainID != nil {
+			fields = append(fields, chainID, uint(0), uint(0))
+		}
+		enc, _ := rlp.EncodeToBytes(fields)
+		return crypto.Keccak256Hash(enc)
+	}
+	enc, _ := rlp.EncodeToBytes(fields)
+	return crypto.Keccak256Hash([]byte{tx.Type}, enc)
+}
+
+// Protected indica si la firma está ligada a un chain ID. Las tipadas siempre
+// lo están; las legacy si V no es 27/28.
+func (tx *RawTx) Protected() bool {
+	if tx.Type != LegacyTxType {
+		return true
 	}
-	if v != 27 && v != 28 {
-		return common.Address{}, errors.New("invalid signature (V)")
+	if tx.V == nil || !tx.V.IsUint64() {
+		return true
 	}
+	v := tx.V.Uint64()
+	return v != 27 && v != 28
+}
 
-	// Combine R, S, V en un signature de 65 bytes
-	sig := make([]byte, 65)
-	copy(sig[0:32], tx.R.Bytes())
-	copy(sig[32:64], tx.S.Bytes())
-	sig[64] = byte(v - 27) // 0 o 1
+// VerifySignature comprueba la firma y devuelve el emisor (From). Las firmas
+// con chain ID deben ser para `chainID`; las de otra cadena se rechazan.
+// Las legacy sin chain ID (V = 27/28) son válidas en un bloque, como en
+// Ethereum, pero el pool no las acepta salvo con TxPoolConfig.AllowUnprotected.
+func (tx *RawTx) VerifySignature(chainID *big.Int) (common.Address, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return common.Address{}, ErrInvalidSig
+	}
+	switch {
+	case tx.Type == AccessListTxType || tx.Type == DynamicFeeTxType:
+		if tx.ChainID == nil || tx.ChainID.Cmp(chainID) != 0 {
+			return common.Address{}, fmt.Errorf("%w: have %d want %d", ErrInvalidChainId, tx.ChainID, chainID)
+		}
+	case tx.Type != LegacyTxType:
+		return common.Address{}, ErrTxTypeNotSupported
+	case tx.Protected():
+		if txChainID := deriveChainID(tx.V); txChainID.Cmp(chainID) != 0 {
+			return common.Address{}, fmt.Errorf("%w: have %d want %d", ErrInvalidChainId, txChainID, chainID)
+		}
+	}
+	return tx.From()
+}
 
-	// 3. Recuperamos la public key
-	pubKey, err := crypto.Ecrecover(sigHash, sig)
+// From devuelve el emisor de la transacción, recuperado de la firma (V,R,S)
+// con el chain ID que lleva la propia TX. La recuperación es cara (ecrecover),
+// así que el resultado se guarda y las siguientes llamadas lo reutilizan.
+func (tx *RawTx) From() (common.Address, error) {
+	if from := tx.from.Load(); from != nil {
+		return *from, nil
+	}
+	from, err := tx.recoverSender()
 	if err != nil {
 		return common.Address{}, err
 	}
-	if len(pubKey) == 0 {
-		return common.Address{}, errors.New("invalid pubkey from signature")
+	tx.from.Store(&from)
+	return from, nil
+}
+
+// recoverSender recupera la dirección que firmó la transacción.
+func (tx *RawTx) recoverSender() (common.Address, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return common.Address{}, ErrInvalidSig
+	}
+
+	// 1. Según el tipo y V sabemos qué hash se firmó y recuperamos el recovery id (0 o 1)
+	var (
+		sigHash common.Hash
+		recID   *big.Int
+	)
+	switch {
+	case tx.Type == AccessListTxType || tx.Type == DynamicFeeTxType:
+		if tx.ChainID == nil {
+			return common.Address{}, ErrInvalidChainId
+		}
+		sigHash = tx.SigningHash(tx.ChainID)
+		recID = tx.V
+	case tx.Type != LegacyTxType:
+		return common.Address{}, ErrTxTypeNotSupported
+	case !tx.Protected():
+		sigHash = tx.SigningHash(nil)
+		recID = new(big.Int).Sub(tx.V, big.NewInt(27))
+	default:
+		// V = chainId*2 + 35 + recID
+		chainID := deriveChainID(tx.V)
+		sigHash = tx.SigningHash(chainID)
+		recID = new(big.Int).Sub(tx.V, new(big.Int).Mul(chainID, big.NewInt(2)))
+		recID.Sub(recID, big.NewInt(35))
+	}
+	if recID.Sign() < 0 || !recID.IsUint64() || recID.Uint64() > 1 || !crypto.ValidateSignatureValues(byte(recID.Uint64()), tx.R, tx.S, true) {
+		return common.Address{}, ErrInvalidSig
 	}
 
-	// 4. Convertimos pubkey en *ecdsa.PublicKey para obtener la address
-	pubKeyECDSA, err := crypto.UnmarshalPubkey(pubKey)
+	// 2. Combine R, S, V en un signature de 65 bytes (R y S con ceros a la izquierda)
+	sig := make([]byte, crypto.SignatureLength)
+	tx.R.FillBytes(sig[0:32])
+	tx.S.FillBytes(sig[32:64])
+	sig[64] = byte(recID.Uint64())
+
+	// 3. Recuperamos la public key y de ella la address
+	pubKey, err := crypto.SigToPub(sigHash.Bytes(), sig)
 	if err != nil {
 		return common.Address{}, err
 	}
-	recoveredAddr := crypto.PubkeyToAddress(*pubKeyECDSA)
-	return recoveredAddr, nil
-}
-
-// RawTxHash (simplificado) - en Ethereum se usa RLP. Aqui, una función mock
-func RawTxHash(tx *RawTx) []byte {
-	// O usar rlp.EncodeToBytes(...)
-	// Para ejemplo, supongamos un keccak256 de:
-	// nonce + to + value
-	toBytes := tx.To.Bytes()
-	data := append(
-		append(
-			common.BigToHash(new(big.Int).SetUint64(tx.Nonce)).Bytes(),
-			toBytes...,
-		),
-		tx.Value.Bytes()...,
-	)
-	h := crypto.Keccak256Hash(data)
-	return h.Bytes()
-}
-
-// applyTxAndCreateBlock añade la TX a un nuevo bloque, lo aplica al State y actualiza el blockchain
-func (tx *RawTx) ApplyTxAndCreateBlock(from common.Address, chain *[]*Block, state *State) (string, error) {
-	// 1. Validar nonce
-	currentNonce := state.GetNonce(from.Hex())
-	fmt.Printf("From: %s \n", from.Hex())
-	fmt.Printf("currentNonce %d \n", currentNonce)
-	if tx.Nonce != currentNonce {
-		return "", fmt.Errorf("invalid nonce: got %d, expected %d", tx.Nonce, currentNonce)
-	}
-
-	// 2. Validar balance
-	fmt.Printf("From: %s Balance: %d \n", from.Hex(), state.Balances[from.Hex()])
-	balance := state.Balances[from.Hex()]
-	txValue := tx.Value.Uint64()
-	fmt.Printf("txValue: %d \n", txValue)
-	if balance < txValue {
-		return "", fmt.Errorf("insufficient balance")
-	}
-	// 3. Aplicar transacción (transferencia)
-	state.Balances[from.Hex()] = balance - txValue
-	state.Balances[tx.To.Hex()] = state.Balances[tx.To.Hex()] + txValue
-	state.IncrementNonce(from.Hex())
-	state.UpdateMerkle()
-
-	// 4. Crear un nuevo bloque con esta TX
-	//newBlock := srv.createBlock([]core.DecodedTx{tx})
-
-	stateRoot, _ := state.Root()
-	fmt.Printf("TX: %+v\n", tx)
-	newBlock := CreateBlock(*chain, []RawTx{*tx}, stateRoot)
-	// Lo añadimos a la "blockchain" (en tu caso, podrías tener un array de bloques)
-	fmt.Printf("newBlock: %v \n", newBlock)
-	*chain = append(*chain, newBlock)
-	fmt.Printf("chain: %+v \n", chain)
-	// (Opcional) Llamar a tu mecanismo de consenso, broadcast, etc.
-	log.Printf("New block created #%d with 1 TX\n", newBlock.Header.BlockNumber)
-
-	txHash := common.BytesToHash(RawTxHash(tx))
-	return txHash.Hex(), nil
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+// deriveChainID obtiene el chain ID de una V protegida por EIP-155.
+func deriveChainID(v *big.Int) *big.Int {
+	chainID := new(big.Int).Sub(v, big.NewInt(35))
+	return chainID.Rsh(chainID, 1)
+}
 
+// Hash es el identificador estándar de la transacción: keccak de su codificación
+// canónica (rlp(tx) en legacy, tipo || rlp(payload) en tipadas), el mismo que
+// calculan MetaMask, ethers o geth.
+func (tx *RawTx) Hash() common.Hash {
+	enc, _ := tx.MarshalBinary()
+	return crypto.Keccak256Hash(enc)
 }
@@ -0,0 +1,92 @@
+// core/transaction_test.go
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// toRawTx pasa una TX firmada con go-ethereum a RawTx por su codificación binaria.
+func toRawTx(t testing.TB, signed *types.Transaction) *RawTx {
+	t.Helper()
+	enc, err := signed.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := new(RawTx)
+	if err := tx.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestVerifySignatureChainID(t *testing.T) {
+	bc, _, key := newTestChain(t, storage.NewMemoryDB())
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0xf17f52151EbEF6C7334FAD080c5704D77216b732")
+	chainID := DefaultChainConfig().ChainID
+	otherChain := big.NewInt(1)
+
+	legacy := func(signer types.Signer) *RawTx {
+		signed, err := types.SignTx(types.NewTx(&types.LegacyTx{
+			Nonce: 0, GasPrice: big.NewInt(1e10), Gas: 21000, To: &to, Value: big.NewInt(1),
+		}), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return toRawTx(t, signed)
+	}
+
+	// Firmada para la cadena del nodo: válida y con su emisor
+	tx := legacy(types.NewEIP155Signer(chainID))
+	if !tx.Protected() {
+		t.Fatal("EIP-155 tx not protected")
+	}
+	if from, err := tx.VerifySignature(chainID); err != nil || from != sender {
+		t.Fatalf("EIP-155 tx for chain %d: from %s, err %v, want %s", chainID, from.Hex(), err, sender.Hex())
+	}
+
+	// Firmada para otra cadena: rechazada, sea legacy o tipada
+	if _, err := legacy(types.NewEIP155Signer(otherChain)).VerifySignature(chainID); !errors.Is(err, ErrInvalidChainId) {
+		t.Fatalf("legacy tx for chain 1: have %v, want %v", err, ErrInvalidChainId)
+	}
+	signed, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID: otherChain, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1e10), Gas: 21000, To: &to,
+	}), types.NewLondonSigner(otherChain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toRawTx(t, signed).VerifySignature(chainID); !errors.Is(err, ErrInvalidChainId) {
+		t.Fatalf("dynamic fee tx for chain 1: have %v, want %v", err, ErrInvalidChainId)
+	}
+
+	// Sin chain ID (V = 27/28): la firma es válida, pero el pool la rechaza
+	unprotected := legacy(types.HomesteadSigner{})
+	if unprotected.Protected() {
+		t.Fatal("homestead tx reported as protected")
+	}
+	if from, err := unprotected.VerifySignature(chainID); err != nil || from != sender {
+		t.Fatalf("unprotected tx: from %s, err %v, want %s", from.Hex(), err, sender.Hex())
+	}
+
+	pool := NewTxPool(bc, TxPoolConfig{})
+	defer pool.Stop()
+	if _, err := pool.Add(unprotected); !errors.Is(err, ErrUnprotectedTx) {
+		t.Fatalf("pool accepted unprotected tx: %v", err)
+	}
+	if _, err := pool.Add(tx); err != nil {
+		t.Fatalf("pool rejected EIP-155 tx: %v", err)
+	}
+
+	permissive := NewTxPool(bc, TxPoolConfig{AllowUnprotected: true})
+	defer permissive.Stop()
+	if _, err := permissive.Add(unprotected); err != nil {
+		t.Fatalf("pool with AllowUnprotected rejected unprotected tx: %v", err)
+	}
+}
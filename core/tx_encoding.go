@@ -0,0 +1,195 @@
+// core/tx_encoding.go
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tipos de transacción (EIP-2718)
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01 // EIP-2930
+	DynamicFeeTxType = 0x02 // EIP-1559
+)
+
+var (
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	errShortTypedTx       = errors.New("typed transaction too short")
+)
+
+// legacyTxRLP es el formato RLP de las transacciones legacy:
+// rlp([nonce, gasPrice, gas, to, value, data, v, r, s])
+type legacyTxRLP struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	GasLimit *big.Int
+	To       *common.Address `rlp:"nil"`
+	Value    *big.Int
+	Data     []byte
+	V, R, S  *big.Int
+}
+
+// accessListTxRLP es el payload de una TX tipo 0x01
+type accessListTxRLP struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasPrice   *big.Int
+	GasLimit   *big.Int
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+	V, R, S    *big.Int
+}
+
+// dynamicFeeTxRLP es el payload de una TX tipo 0x02
+type dynamicFeeTxRLP struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	GasLimit   *big.Int
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+	V, R, S    *big.Int
+}
+
+// payload devuelve la estructura RLP que corresponde al tipo de la TX.
+func (tx *RawTx) payload() (interface{}, error) {
+	switch tx.Type {
+	case LegacyTxType:
+		return &legacyTxRLP{tx.Nonce, tx.GasPrice, tx.GasLimit, tx.To, tx.Value, tx.Data, tx.V, tx.R, tx.S}, nil
+	case AccessListTxType:
+		return &accessListTxRLP{tx.ChainID, tx.Nonce, tx.GasPrice, tx.GasLimit, tx.To, tx.Value, tx.Data, tx.AccessList, tx.V, tx.R, tx.S}, nil
+	case DynamicFeeTxType:
+		return &dynamicFeeTxRLP{tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.GasLimit, tx.To, tx.Value, tx.Data, tx.AccessList, tx.V, tx.R, tx.S}, nil
+	}
+	return nil, ErrTxTypeNotSupported
+}
+
+// MarshalBinary devuelve la codificación canónica (la que firma y envía una wallet):
+// rlp(tx) para legacy y `tipo || rlp(payload)` para las tipadas.
+func (tx *RawTx) MarshalBinary() ([]byte, error) {
+	payload, err := tx.payload()
+	if err != nil {
+		return nil, err
+	}
+	if tx.Type == LegacyTxType {
+		return rlp.EncodeToBytes(payload)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(tx.Type)
+	if err := rlp.Encode(&buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodifica una TX en formato canónico (sobre EIP-2718).
+func (tx *RawTx) UnmarshalBinary(b []byte) error {
+	if len(b) > 0 && b[0] > 0x7f {
+		// Es una lista RLP: transacción legacy
+		var dec legacyTxRLP
+		if err := rlp.DecodeBytes(b, &dec); err != nil {
+			return err
+		}
+		*tx = RawTx{
+			Type:     LegacyTxType,
+			Nonce:    dec.Nonce,
+			GasPrice: dec.GasPrice,
+			GasLimit: dec.GasLimit,
+			To:       dec.To,
+			Value:    dec.Value,
+			Data:     dec.Data,
+			V:        dec.V, R: dec.R, S: dec.S,
+		}
+		return nil
+	}
+	if len(b) <= 1 {
+		return errShortTypedTx
+	}
+	switch b[0] {
+	case AccessListTxType:
+		var dec accessListTxRLP
+		if err := rlp.DecodeBytes(b[1:], &dec); err != nil {
+			return err
+		}
+		*tx = RawTx{
+			Type:       AccessListTxType,
+			ChainID:    dec.ChainID,
+			Nonce:      dec.Nonce,
+			GasPrice:   dec.GasPrice,
+			GasLimit:   dec.GasLimit,
+			To:         dec.To,
+			Value:      dec.Value,
+			Data:       dec.Data,
+			AccessList: dec.AccessList,
+			V:          dec.V, R: dec.R, S: dec.S,
+		}
+	case DynamicFeeTxType:
+		var dec dynamicFeeTxRLP
+		if err := rlp.DecodeBytes(b[1:], &dec); err != nil {
+			return err
+		}
+		*tx = RawTx{
+			Type:       DynamicFeeTxType,
+			ChainID:    dec.ChainID,
+			Nonce:      dec.Nonce,
+			GasTipCap:  dec.GasTipCap,
+			GasFeeCap:  dec.GasFeeCap,
+			GasLimit:   dec.GasLimit,
+			To:         dec.To,
+			Value:      dec.Value,
+			Data:       dec.Data,
+			AccessList: dec.AccessList,
+			V:          dec.V, R: dec.R, S: dec.S,
+		}
+	default:
+		return fmt.Errorf("%w: 0x%x", ErrTxTypeNotSupported, b[0])
+	}
+	return nil
+}
+
+// EncodeRLP implementa rlp.Encoder. Dentro de un bloque las legacy van como
+// lista RLP y las tipadas como un string RLP con su sobre EIP-2718.
+func (tx *RawTx) EncodeRLP(w io.Writer) error {
+	if tx.Type == LegacyTxType {
+		payload, _ := tx.payload()
+		return rlp.Encode(w, payload)
+	}
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(w, enc)
+}
+
+// DecodeRLP implementa rlp.Decoder, inverso de EncodeRLP.
+func (tx *RawTx) DecodeRLP(s *rlp.Stream) error {
+	kind, _, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	if kind == rlp.List {
+		raw, err := s.Raw()
+		if err != nil {
+			return err
+		}
+		return tx.UnmarshalBinary(raw)
+	}
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	return tx.UnmarshalBinary(b)
+}
@@ -0,0 +1,106 @@
+// core/tx_encoding_test.go
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestTxEncodingAgainstGeth firma TXs de los tres tipos con go-ethereum y
+// comprueba que RawTx las decodifica, las vuelve a codificar byte a byte igual,
+// calcula el mismo hash y hash de firma, y recupera el mismo emisor.
+func TestTxEncodingAgainstGeth(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	chainID := DefaultChainConfig().ChainID
+	signer := types.LatestSignerForChainID(chainID)
+	to := common.HexToAddress("0xf17f52151EbEF6C7334FAD080c5704D77216b732")
+	accessList := types.AccessList{{
+		Address:     to,
+		StorageKeys: []common.Hash{{0x01}, {0x02}},
+	}}
+
+	tests := []struct {
+		name   string
+		signer types.Signer
+		tx     types.TxData
+	}{
+		{"legacy eip155", signer, &types.LegacyTx{
+			Nonce: 1, GasPrice: big.NewInt(2e9), Gas: 21000, To: &to, Value: big.NewInt(2e18),
+		}},
+		{"legacy unprotected", types.HomesteadSigner{}, &types.LegacyTx{
+			Nonce: 2, GasPrice: big.NewInt(1e9), Gas: 50000, To: &to, Data: []byte{0xde, 0xad},
+		}},
+		{"legacy create", signer, &types.LegacyTx{
+			Nonce: 3, GasPrice: big.NewInt(1e9), Gas: 100000, Data: storeInitCode,
+		}},
+		{"access list", signer, &types.AccessListTx{
+			ChainID: chainID, Nonce: 4, GasPrice: big.NewInt(3e9), Gas: 60000, To: &to,
+			Value: big.NewInt(5), Data: []byte{0x01}, AccessList: accessList,
+		}},
+		{"dynamic fee", signer, &types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 5, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(3e10), Gas: 70000,
+			To: &to, Value: big.NewInt(7), Data: []byte{0x02, 0x03}, AccessList: accessList,
+		}},
+		{"dynamic fee create", signer, &types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 6, GasTipCap: big.NewInt(0), GasFeeCap: big.NewInt(1e10), Gas: 100000,
+			Data: storeInitCode,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := types.SignTx(types.NewTx(tt.tx), tt.signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := signed.MarshalBinary()
+
+			tx := toRawTx(t, signed)
+			if tx.Type != signed.Type() || tx.Nonce != signed.Nonce() || tx.Gas() != signed.Gas() ||
+				!reflect.DeepEqual(tx.To, signed.To()) || bigOrZero(tx.Value).Cmp(signed.Value()) != 0 ||
+				!bytes.Equal(tx.Data, signed.Data()) || len(tx.AccessList) != len(signed.AccessList()) {
+				t.Fatalf("decoded fields differ: %+v", tx)
+			}
+			if tx.GasFeeCapValue().Cmp(signed.GasFeeCap()) != 0 || tx.GasTipCapValue().Cmp(signed.GasTipCap()) != 0 {
+				t.Fatalf("fee caps: have %v/%v, want %v/%v", tx.GasFeeCapValue(), tx.GasTipCapValue(), signed.GasFeeCap(), signed.GasTipCap())
+			}
+
+			// Ida y vuelta: los mismos bytes, y go-ethereum los acepta
+			enc, err := tx.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, want) {
+				t.Fatalf("re-encoding differs:\nhave %x\nwant %x", enc, want)
+			}
+			var back types.Transaction
+			if err := back.UnmarshalBinary(enc); err != nil || back.Hash() != signed.Hash() {
+				t.Fatalf("geth decode of our encoding: hash %s, err %v", back.Hash().Hex(), err)
+			}
+
+			if tx.Hash() != signed.Hash() {
+				t.Fatalf("hash: have %s, want %s", tx.Hash().Hex(), signed.Hash().Hex())
+			}
+			sigChainID := chainID
+			if !signed.Protected() {
+				sigChainID = nil
+			}
+			if have, want := tx.SigningHash(sigChainID), tt.signer.Hash(signed); have != want {
+				t.Fatalf("signing hash: have %s, want %s", have.Hex(), want.Hex())
+			}
+
+			wantFrom, err := types.Sender(tt.signer, signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from, err := tx.VerifySignature(chainID); err != nil || from != wantFrom {
+				t.Fatalf("sender: have %s (%v), want %s", from.Hex(), err, wantFrom.Hex())
+			}
+		})
+	}
+}
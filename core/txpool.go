@@ -0,0 +1,234 @@
+// core/txpool.go
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+var (
+	ErrAlreadyKnown       = errors.New("already known")
+	ErrNonceTooLow        = errors.New("nonce too low")
+	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
+	ErrTxGasLimit         = errors.New("exceeds block gas limit")
+	ErrUnprotectedTx      = errors.New("only replay-protected (EIP-155) transactions allowed")
+)
+
+// TxPoolConfig configura qué transacciones acepta el pool.
+type TxPoolConfig struct {
+	// AllowUnprotected acepta TXs legacy firmadas sin chain ID (V = 27/28).
+	// Esas firmas valen en cualquier cadena, así que cualquiera podría
+	// reproducir aquí una TX de otra red: solo para pruebas, como
+	// --rpc.allow-unprotected-txs en geth.
+	AllowUnprotected bool
+}
+
+// TxPool guarda las transacciones pendientes hasta que el productor de bloques
+// las incluye. Las transacciones se indexan por emisor y nonce.
+type TxPool struct {
+	mu     sync.RWMutex
+	bc     *Blockchain
+	config TxPoolConfig
+
+	pending map[common.Address]map[uint64]*RawTx // emisor -> nonce -> tx
+	all     map[common.Hash]*RawTx               // hash -> tx
+
+	headSub event.Subscription
+	quit    chan struct{}
+}
+
+// NewTxPool crea el pool y empieza a escuchar las nuevas cabezas de la cadena
+// para descartar las transacciones ya incluidas.
+func NewTxPool(bc *Blockchain, config TxPoolConfig) *TxPool {
+	pool := &TxPool{
+		bc:      bc,
+		config:  config,
+		pending: make(map[common.Address]map[uint64]*RawTx),
+		all:     make(map[common.Hash]*RawTx),
+		quit:    make(chan struct{}),
+	}
+	heads := make(chan ChainHeadEvent, 16)
+	pool.headSub = bc.SubscribeChainHeadEvent(heads)
+	go pool.loop(heads)
+	return pool
+}
+
+func (pool *TxPool) loop(heads chan ChainHeadEvent) {
+	defer pool.headSub.Unsubscribe()
+	for {
+		select {
+		case ev := <-heads:
+			pool.reinject(ev.Dropped)
+			pool.demoteStale()
+		case <-pool.headSub.Err():
+			return
+		case <-pool.quit:
+			return
+		}
+	}
+}
+
+// Stop deja de escuchar la cadena.
+func (pool *TxPool) Stop() {
+	close(pool.quit)
+}
+
+// Add verifica la firma de la transacción, hace las comprobaciones baratas
+// contra el estado de la cabeza y la guarda como pendiente. Las TXs sin
+// protección contra replay se rechazan salvo con AllowUnprotected.
+func (pool *TxPool) Add(tx *RawTx) (common.Hash, error) {
+	if !tx.Protected() && !pool.config.AllowUnprotected {
+		return common.Hash{}, ErrUnprotectedTx
+	}
+	from, err := tx.VerifySignature(pool.bc.Config().ChainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hash := tx.Hash()
+
+	if gas := IntrinsicGas(tx.Data, tx.AccessList, tx.IsCreate()); tx.Gas() < gas {
+		return common.Hash{}, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.Gas(), gas)
+	}
+	if tx.Gas() > pool.bc.CurrentBlock().Header.GasLimit {
+		return common.Hash{}, ErrTxGasLimit
+	}
+
+	state := pool.bc.State()
+	if tx.Nonce < state.GetNonce(from) {
+		return common.Hash{}, ErrNonceTooLow
+	}
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCapValue())
+	cost.Add(cost, bigOrZero(tx.Value))
+	if state.GetBalance(from).ToBig().Cmp(cost) < 0 {
+		return common.Hash{}, ErrInsufficientFunds
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if _, ok := pool.all[hash]; ok {
+		return common.Hash{}, ErrAlreadyKnown
+	}
+	if pool.pending[from] == nil {
+		pool.pending[from] = make(map[uint64]*RawTx)
+	}
+	// Misma cuenta y nonce: solo se reemplaza si sube tanto el fee cap como la propina
+	if old := pool.pending[from][tx.Nonce]; old != nil {
+		if tx.GasFeeCapValue().Cmp(old.GasFeeCapValue()) <= 0 || tx.GasTipCapValue().Cmp(old.GasTipCapValue()) <= 0 {
+			return common.Hash{}, ErrReplaceUnderpriced
+		}
+		delete(pool.all, old.Hash())
+	}
+	pool.pending[from][tx.Nonce] = tx
+	pool.all[hash] = tx
+
+	log.Printf("[TxPool] Added tx %s from %s nonce %d\n", hash.Hex(), from.Hex(), tx.Nonce)
+	return hash, nil
+}
+
+// Get devuelve una transacción pendiente por hash.
+func (pool *TxPool) Get(hash common.Hash) *RawTx {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	return pool.all[hash]
+}
+
+// Nonce devuelve el siguiente nonce de `from` contando las TXs del pool: el
+// nonce en la cabeza más las TXs pendientes que lo siguen sin huecos, las
+// mismas que Pending considera ejecutables. Es el que da eth_getTransactionCount
+// con "pending", así una wallet puede enviar varias TXs seguidas sin esperar a
+// que se sellen; una TX detrás de un hueco no cuenta, porque la siguiente
+// firmada con ese nonce también se quedaría atascada.
+func (pool *TxPool) Nonce(from common.Address) uint64 {
+	nonce := pool.bc.State().GetNonce(from)
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	txs := pool.pending[from]
+	for {
+		if _, ok := txs[nonce]; !ok {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// RemoveFrom descarta la transacción de `from` con nonce `nonce` y todas las
+// siguientes de la cuenta (p.ej. si no se pudo ejecutar): sin ella habría un
+// hueco de nonce y las demás no podrían incluirse nunca.
+func (pool *TxPool) RemoveFrom(from common.Address, nonce uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for n := range pool.pending[from] {
+		if n >= nonce {
+			pool.removeLocked(from, n)
+		}
+	}
+}
+
+func (pool *TxPool) removeLocked(from common.Address, nonce uint64) {
+	txs := pool.pending[from]
+	if tx, ok := txs[nonce]; ok {
+		delete(pool.all, tx.Hash())
+		delete(txs, nonce)
+	}
+	if len(txs) == 0 {
+		delete(pool.pending, from)
+	}
+}
+
+// Pending devuelve, por emisor, las transacciones ejecutables sobre la cabeza
+// actual: las que continúan el nonce de la cuenta sin huecos, ordenadas por nonce.
+func (pool *TxPool) Pending() map[common.Address][]*RawTx {
+	state := pool.bc.State()
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pending := make(map[common.Address][]*RawTx)
+	for from, txs := range pool.pending {
+		nonce := state.GetNonce(from)
+		for {
+			tx, ok := txs[nonce]
+			if !ok {
+				break
+			}
+			pending[from] = append(pending[from], tx)
+			nonce++
+		}
+	}
+	return pending
+}
+
+// reinject vuelve a añadir las TXs que un reorg sacó de la cadena. Las que la
+// nueva rama ya no admite (p.ej. su nonce se usó en ella) se descartan.
+func (pool *TxPool) reinject(txs []*RawTx) {
+	for _, tx := range txs {
+		if _, err := pool.Add(tx); err != nil && !errors.Is(err, ErrAlreadyKnown) {
+			log.Printf("[TxPool] Dropped reorged tx %s: %v\n", tx.Hash().Hex(), err)
+		}
+	}
+}
+
+// demoteStale elimina las transacciones cuyo nonce ya fue usado en la cadena.
+func (pool *TxPool) demoteStale() {
+	state := pool.bc.State()
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for from, txs := range pool.pending {
+		nonce := state.GetNonce(from)
+		for n := range txs {
+			if n < nonce {
+				pool.removeLocked(from, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// core/validator.go
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrUnknownParent    = errors.New("unknown parent")
+	ErrInvalidNumber    = errors.New("invalid block number")
+	ErrInvalidTimestamp = errors.New("timestamp not greater than parent")
+	ErrInvalidGasLimit  = errors.New("invalid gas limit")
+	ErrInvalidGasUsed   = errors.New("invalid gas used")
+	ErrInvalidBaseFee   = errors.New("invalid base fee")
+)
+
+// ValidateBlock comprueba que `block` es un hijo válido de `parent`:
+// cabecera, firmas, TxRoot y, re-ejecutando las transacciones sobre una copia
+// de `state` (el estado tras `parent`), que el StateRoot coincide. `chain` da
+// acceso a los ancestros para el opcode BLOCKHASH.
+// Devuelve el estado resultante y los recibos para que el llamador los adopte;
+// `state` no se modifica.
+func ValidateBlock(config *ChainConfig, chain ChainContext, parent *Block, block *Block, state *State) (*State, Receipts, error) {
+	header := block.Header
+
+	// 1. Cabecera
+	if header.ParentHash != parent.Hash() {
+		return nil, nil, fmt.Errorf("%w: have %s, want %s", ErrUnknownParent, header.ParentHash.Hex(), parent.Hash().Hex())
+	}
+	if header.BlockNumber != parent.Header.BlockNumber+1 {
+		return nil, nil, fmt.Errorf("%w: have %d, want %d", ErrInvalidNumber, header.BlockNumber, parent.Header.BlockNumber+1)
+	}
+	if header.Timestamp <= parent.Header.Timestamp {
+		return nil, nil, fmt.Errorf("%w: have %d, parent %d", ErrInvalidTimestamp, header.Timestamp, parent.Header.Timestamp)
+	}
+	if !verifyGasLimit(parent.Header.GasLimit, header.GasLimit) {
+		return nil, nil, fmt.Errorf("%w: have %d, parent %d", ErrInvalidGasLimit, header.GasLimit, parent.Header.GasLimit)
+	}
+	if expected := CalcBaseFee(parent.Header); header.BaseFee == nil || header.BaseFee.Cmp(expected) != 0 {
+		return nil, nil, fmt.Errorf("%w: have %v, want %v", ErrInvalidBaseFee, header.BaseFee, expected)
+	}
+	if header.GasUsed > header.GasLimit {
+		return nil, nil, fmt.Errorf("%w: have %d, limit %d", ErrInvalidGasUsed, header.GasUsed, header.GasLimit)
+	}
+
+	// 2. Firmas de todas las transacciones
+	senders := make([]common.Address, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		from, err := tx.VerifySignature(config.ChainID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tx %d: invalid signature: %v", i, err)
+		}
+		senders[i] = from
+	}
+
+	// 3. Raíz de transacciones
+	if root := DeriveTxRoot(block.Transactions); root != header.TxRoot {
+		return nil, nil, fmt.Errorf("tx root mismatch: have %s, want %s", header.TxRoot.Hex(), root.Hex())
+	}
+
+	// 4. Re-ejecución sobre una copia del estado
+	post := state.Copy()
+	receipts := make(Receipts, len(block.Transactions))
+	var usedGas uint64
+	for i, tx := range block.Transactions {
+		receipt, err := ApplyTransaction(config, chain, post, header, senders[i], tx, &usedGas)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tx %d: %v", i, err)
+		}
+		receipts[i] = receipt
+	}
+	if usedGas != header.GasUsed {
+		return nil, nil, fmt.Errorf("%w: have %d, want %d", ErrInvalidGasUsed, header.GasUsed, usedGas)
+	}
+	if root := DeriveReceiptsRoot(receipts); root != header.ReceiptsRoot {
+		return nil, nil, fmt.Errorf("receipts root mismatch: have %s, want %s", header.ReceiptsRoot.Hex(), root.Hex())
+	}
+	if err := post.UpdateMerkle(); err != nil {
+		return nil, nil, fmt.Errorf("state root: %w", err)
+	}
+	if root := post.Root(); root != header.StateRoot {
+		return nil, nil, fmt.Errorf("state root mismatch: have %s, want %s", header.StateRoot.Hex(), root.Hex())
+	}
+	return post, receipts, nil
+}
@@ -0,0 +1,103 @@
+// rpc/rpc_blockparam.go
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	errHeaderNotFound = errors.New("header not found")
+	errNotCanonical   = errors.New("hash is not currently canonical")
+)
+
+// resolveBlock interpreta el parámetro de bloque de los métodos que leen
+// estado (eth_getBalance, eth_getTransactionCount...). Acepta:
+//   - un número en hex: "0x1b"
+//   - una etiqueta: "earliest", "latest", "pending", "safe" o "finalized"
+//   - un objeto EIP-1898: {"blockNumber": "0x1b"} o
+//     {"blockHash": "0x...", "requireCanonical": true}
+func resolveBlock(srv *RPCServer, param interface{}) (*core.Block, error) {
+	switch v := param.(type) {
+	case string:
+		return blockByNumber(srv.Blockchain, v)
+	case map[string]interface{}:
+		return blockByNumberOrHash(srv.Blockchain, v)
+	}
+	return nil, fmt.Errorf("invalid block param: %v", param)
+}
+
+// blockByNumber resuelve una etiqueta o un número hex a un bloque canónico.
+func blockByNumber(bc *core.Blockchain, param string) (*core.Block, error) {
+	switch param {
+	case "latest", "pending":
+		// No hay bloque pendiente: el siguiente se construye al sellarlo
+		return bc.CurrentBlock(), nil
+	case "safe", "finalized":
+		// Con un único productor no hay capa de finalidad aparte, lo más
+		// seguro que conocemos es la cabeza
+		return bc.CurrentBlock(), nil
+	case "earliest":
+		return bc.Genesis(), nil
+	}
+	if !strings.HasPrefix(param, "0x") {
+		return nil, fmt.Errorf("invalid block param: %q", param)
+	}
+	number, err := strconv.ParseUint(param[2:], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q: %v", param, err)
+	}
+	block := bc.GetBlockByNumber(number)
+	if block == nil {
+		return nil, errHeaderNotFound
+	}
+	return block, nil
+}
+
+// blockByNumberOrHash resuelve un objeto EIP-1898. Con "blockHash" vale
+// cualquier bloque conocido, salvo que "requireCanonical" exija que esté en
+// la cadena canónica.
+func blockByNumberOrHash(bc *core.Blockchain, param map[string]interface{}) (*core.Block, error) {
+	number, hasNumber := param["blockNumber"]
+	hash, hasHash := param["blockHash"]
+	if hasNumber == hasHash {
+		return nil, fmt.Errorf("invalid block param: exactly one of blockNumber or blockHash is required")
+	}
+	if hasNumber {
+		s, ok := number.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid blockNumber: %v", number)
+		}
+		return blockByNumber(bc, s)
+	}
+
+	s, ok := hash.(string)
+	if !ok || !strings.HasPrefix(s, "0x") || len(s) != 2+2*common.HashLength {
+		return nil, fmt.Errorf("invalid blockHash: %v", hash)
+	}
+	block := bc.GetBlockByHash(common.HexToHash(s))
+	if block == nil {
+		return nil, fmt.Errorf("header for hash %s not found", s)
+	}
+	if requireCanonical, _ := param["requireCanonical"].(bool); requireCanonical {
+		if canonical := bc.GetBlockByNumber(block.Header.BlockNumber); canonical == nil || canonical.Hash() != block.Hash() {
+			return nil, errNotCanonical
+		}
+	}
+	return block, nil
+}
+
+// stateAtBlock devuelve, para leerlo, el estado tras el bloque indicado por
+// `param`. Los bloques antiguos solo tienen estado si el nodo está en modo archivo.
+func stateAtBlock(srv *RPCServer, param interface{}) (*core.State, error) {
+	block, err := resolveBlock(srv, param)
+	if err != nil {
+		return nil, err
+	}
+	return srv.Blockchain.ReadStateAt(block.Hash())
+}
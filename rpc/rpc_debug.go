@@ -0,0 +1,99 @@
+// rpc/rpc_debug.go
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// StateDiffResult es la respuesta de debug_stateDiff: las cuentas que cambió
+// un bloque, con su valor antes y después del bloque.
+type StateDiffResult struct {
+	BlockNumber hexutil.Uint64      `json:"blockNumber"`
+	BlockHash   common.Hash         `json:"blockHash"`
+	Accounts    []AccountDiffResult `json:"accounts"`
+}
+
+// AccountDiffResult es el cambio de una cuenta. Before es null si la cuenta
+// no existía antes del bloque y After si el bloque la borró.
+type AccountDiffResult struct {
+	Address common.Address                    `json:"address"`
+	Before  *AccountStateResult               `json:"before"`
+	After   *AccountStateResult               `json:"after"`
+	Code    hexutil.Bytes                     `json:"code,omitempty"`
+	Storage map[common.Hash]StorageDiffResult `json:"storage,omitempty"`
+}
+
+// AccountStateResult es una cuenta a un lado del diff.
+type AccountStateResult struct {
+	Balance  *hexutil.Big   `json:"balance"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	CodeHash common.Hash    `json:"codeHash"`
+}
+
+// StorageDiffResult es el valor de un slot antes y después del bloque.
+type StorageDiffResult struct {
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+// NewStateDiffResult pasa un core.StateDiff al formato JSON de debug_stateDiff.
+// Lo usa también el volcado de la CLI, así los dos dan la misma salida.
+func NewStateDiffResult(diff *core.StateDiff) *StateDiffResult {
+	result := &StateDiffResult{
+		BlockNumber: hexutil.Uint64(diff.BlockNumber),
+		BlockHash:   diff.BlockHash,
+		Accounts:    make([]AccountDiffResult, len(diff.Accounts)),
+	}
+	for i, acc := range diff.Accounts {
+		accResult := AccountDiffResult{
+			Address: acc.Address,
+			Before:  newAccountStateResult(acc.Before),
+			After:   newAccountStateResult(acc.After),
+			Code:    acc.Code,
+		}
+		if len(acc.Storage) > 0 {
+			accResult.Storage = make(map[common.Hash]StorageDiffResult, len(acc.Storage))
+			for _, slot := range acc.Storage {
+				accResult.Storage[slot.Slot] = StorageDiffResult{Before: slot.Before, After: slot.After}
+			}
+		}
+		result.Accounts[i] = accResult
+	}
+	return result
+}
+
+func newAccountStateResult(acc *core.AccountState) *AccountStateResult {
+	if acc == nil {
+		return nil
+	}
+	return &AccountStateResult{
+		Balance:  (*hexutil.Big)(acc.Balance.ToBig()),
+		Nonce:    hexutil.Uint64(acc.Nonce),
+		CodeHash: acc.CodeHash,
+	}
+}
+
+// HandleStateDiff devuelve los cambios de estado de un bloque canónico.
+// Params: [bloque] (número o etiqueta, como en eth_getBlockByNumber)
+func HandleStateDiff(srv *RPCServer, params []interface{}) (*StateDiffResult, error) {
+	if len(params) < 1 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	number, err := parseBlockNumber(srv, params[0])
+	if err != nil {
+		return nil, err
+	}
+	block := srv.Blockchain.GetBlockByNumber(number)
+	if block == nil {
+		return nil, errHeaderNotFound
+	}
+	diff := srv.Blockchain.GetStateDiff(block.Hash())
+	if diff == nil {
+		return nil, fmt.Errorf("state diff of block #%d not available", number)
+	}
+	return NewStateDiffResult(diff), nil
+}
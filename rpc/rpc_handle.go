@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"github.com/edumar111/my-geth-edu/core"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -18,29 +19,119 @@ func HandleGetTransactionCount(srv *RPCServer, params []interface{}) (string, er
 	if len(params) < 2 {
 		return "", fmt.Errorf("invalid params")
 	}
-	address, ok := params[0].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid address param")
-	}
-	blockParam, ok := params[1].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid block param")
+	address, err := parseAddress(params[0])
+	if err != nil {
+		return "", err
 	}
-	if blockParam != "latest" {
-		return "", fmt.Errorf("only 'latest' blockParam is supported")
+	state, err := stateAtBlock(srv, params[1])
+	if err != nil {
+		return "", err
 	}
 
-	nonce := srv.State.GetNonce(address)
+	nonce := state.GetNonce(address)
+	if tag, ok := params[1].(string); ok && tag == "pending" && srv.TxPool != nil {
+		// "pending" cuenta también las TXs que esperan en el pool
+		nonce = srv.TxPool.Nonce(address)
+	}
 	// Lo retornamos en formato hex '0x...' como hace Ethereum
 	nonceHex := "0x" + strconv.FormatUint(nonce, 16)
 	return nonceHex, nil
 }
 
-// HandleSendRawTransaction decodifica la TX en hex RLP, la firma y la inserta en un nuevo bloque
+// HandleGetBalance devuelve el balance en wei de una dirección, en hex
+func HandleGetBalance(srv *RPCServer, params []interface{}) (string, error) {
+	if len(params) < 2 {
+		return "", fmt.Errorf("invalid params")
+	}
+	address, err := parseAddress(params[0])
+	if err != nil {
+		return "", err
+	}
+	state, err := stateAtBlock(srv, params[1])
+	if err != nil {
+		return "", err
+	}
+
+	balance := state.GetBalance(address)
+	return bigIntToHex(balance.ToBig()), nil
+}
+
+// HandleGetStorageAt devuelve el valor de un slot de storage de una cuenta
+// como palabra de 32 bytes en hex: eth_getStorageAt(address, slot, block).
+func HandleGetStorageAt(srv *RPCServer, params []interface{}) (string, error) {
+	if len(params) < 3 {
+		return "", fmt.Errorf("invalid params")
+	}
+	address, err := parseAddress(params[0])
+	if err != nil {
+		return "", err
+	}
+	s, ok := params[1].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid storage key: %v", params[1])
+	}
+	slot, err := parseStorageKey(s)
+	if err != nil {
+		return "", err
+	}
+	state, err := stateAtBlock(srv, params[2])
+	if err != nil {
+		return "", err
+	}
+	return state.GetState(address, slot).Hex(), nil
+}
+
+// HandleCall ejecuta una llamada de solo lectura sobre el estado de un bloque
+// y devuelve lo que retorna el contrato: eth_call({from, to, data}, block).
+// No crea ninguna TX ni cambia el estado.
+func HandleCall(srv *RPCServer, params []interface{}) (string, error) {
+	if len(params) < 1 {
+		return "", fmt.Errorf("invalid params")
+	}
+	args, ok := params[0].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("invalid call object: %v", params[0])
+	}
+	to, err := parseAddress(args["to"])
+	if err != nil {
+		return "", fmt.Errorf("invalid call destination: %w", err)
+	}
+	var from common.Address
+	if args["from"] != nil {
+		if from, err = parseAddress(args["from"]); err != nil {
+			return "", err
+		}
+	}
+	// "input" es el nombre actual del campo; "data" el que usan los clientes antiguos
+	var data []byte
+	for _, field := range []string{"data", "input"} {
+		if hexData, ok := args[field].(string); ok {
+			if data, err = hexutil.Decode(hexData); err != nil {
+				return "", fmt.Errorf("invalid call %s: %v", field, err)
+			}
+		}
+	}
+	blockParam := interface{}("latest")
+	if len(params) > 1 {
+		blockParam = params[1]
+	}
+	block, err := resolveBlock(srv, blockParam)
+	if err != nil {
+		return "", err
+	}
+	state, err := srv.Blockchain.ReadStateAt(block.Hash())
+	if err != nil {
+		return "", err
+	}
+	ret, err := core.Call(srv.Blockchain.Config(), srv.Blockchain, state, block.Header, from, to, data)
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(ret), nil
+}
+
+// HandleSendRawTransaction decodifica la TX en hex RLP, verifica la firma y la añade al pool de pendientes
 func HandleSendRawTransaction(srv *RPCServer, params []interface{}) (string, error) {
-	//TODO solo para probar la demo****************
-	srv.State.Nonces["0x4709421B04e70e3925dFC86307727b588709C7bB"] = 1
-	srv.State.Balances["0x4709421B04e70e3925dFC86307727b588709C7bB"] = 9000000000000000000 //9 ETH
 	// Esperamos un array con 1 string en hex
 	if len(params) < 1 {
 		return "", fmt.Errorf("missing parameter")
@@ -59,34 +150,27 @@ func HandleSendRawTransaction(srv *RPCServer, params []interface{}) (string, err
 		return "", fmt.Errorf("hex decode error: %v", err)
 	}
 
-	// Decodificar via RLP
+	// Decodificar el sobre EIP-2718 (legacy, 0x01 access list o 0x02 EIP-1559)
 	var rawTx core.RawTx
-	err = rlp.DecodeBytes(rawBytes, &rawTx)
+	err = rawTx.UnmarshalBinary(rawBytes)
 	if err != nil {
 		return "", fmt.Errorf("RLP decode error: %v", err)
 	}
 
-	// Verificar firma y extraer "from" address
-	fromAddr, err := rawTx.VerifySignature()
+	// El pool verifica la firma y la guarda hasta que el productor la incluya en un bloque
+	txHash, err := srv.TxPool.Add(&rawTx)
 	if err != nil {
-		return "", fmt.Errorf("signature verify error: %v", err)
-	}
-
-	// Aplicar la transacción al State
-	// (aquí simplificamos: ignoramos gas, etc.)
-	txHash, applyErr := rawTx.ApplyTxAndCreateBlock(fromAddr, &srv.Blockchain, srv.State)
-	fmt.Printf("blockchain final %v+", srv.Blockchain)
-	if applyErr != nil {
-		return "", applyErr
+		return "", err
 	}
 
-	// Por convención, podríamos retornar un "txHash" que sería Keccak(rlp(tx))
+	// El hash es Keccak(rlp(tx)), el mismo que calcula la wallet
 
-	return txHash, nil
+	return txHash.Hex(), nil
 }
 
-// HandleGetTransactionReceipt busca la TX por hash y retorna un objeto JSON
-// con blockNumber, transactionIndex y los campos de RawTx.
+// HandleGetTransactionReceipt busca la TX por hash en el índice de la cadena
+// y retorna su recibo con la forma estándar que esperan ethers y web3.
+// Si la TX no está (aún) en un bloque devuelve null, como Ethereum.
 func HandleGetTransactionReceipt(srv *RPCServer, params []interface{}) (interface{}, error) {
 	if len(params) < 1 {
 		return nil, fmt.Errorf("missing tx hash param")
@@ -100,57 +184,51 @@ func HandleGetTransactionReceipt(srv *RPCServer, params []interface{}) (interfac
 
 	// Convertir el hash a bytes
 	txHashBytes, err := hex.DecodeString(hashParam)
-	if err != nil {
-		return nil, fmt.Errorf("invalid hex tx hash: %v", err)
+	if err != nil || len(txHashBytes) != common.HashLength {
+		return nil, fmt.Errorf("invalid hex tx hash: %s", params[0])
 	}
 
-	// Buscamos la TX en la blockchain
-	blockIndex, txIndex, rawTx := findTransactionByHash(srv, txHashBytes)
-	if rawTx == nil {
-		return nil, fmt.Errorf("transaction not found")
+	// Buscamos la TX y su recibo en el índice hash -> (bloque, posición)
+	txHash := common.BytesToHash(txHashBytes)
+	tx, _, _ := srv.Blockchain.GetTransaction(txHash)
+	receipt := srv.Blockchain.GetReceipt(txHash)
+	if tx == nil || receipt == nil {
+		return nil, nil
 	}
+	return marshalReceipt(tx, receipt), nil
+}
 
-	// Obtenemos blockNumber en hex
-	blockNumHex := "0x" + strconv.FormatUint(srv.Blockchain[blockIndex].Header.BlockNumber, 16)
-	// Obtenemos transactionIndex en hex
-	txIndexHex := "0x" + strconv.FormatUint(uint64(txIndex), 16)
-
-	// Convertir valores a hex
-	nonceHex := "0x" + strconv.FormatUint(rawTx.Nonce, 16)
-	gasPriceHex := bigIntToHex(rawTx.GasPrice)
-	gasLimitHex := bigIntToHex(rawTx.GasLimit)
-	valueHex := bigIntToHex(rawTx.Value)
-	vHex := bigIntToHex(rawTx.V)
-	rHex := bigIntToHex(rawTx.R)
-	sHex := bigIntToHex(rawTx.S)
-
-	// Address en hex (ej. "0xabc123..."), Data en hex
-	toHex := rawTx.To.Hex()
-	dataHex := "0x" + hex.EncodeToString(rawTx.Data)
-
-	// Construimos el objeto que retornaremos
-	receipt := map[string]interface{}{
-		"blockNumber":      blockNumHex,
-		"transactionIndex": txIndexHex,
-
-		"nonce":    nonceHex,
-		"gasPrice": gasPriceHex,
-		"gasLimit": gasLimitHex,
-		"to":       toHex,
-		"value":    valueHex,
-		"data":     dataHex,
-
-		"v": vHex,
-		"r": rHex,
-		"s": sHex,
+// marshalReceipt convierte un recibo al objeto JSON de eth_getTransactionReceipt.
+func marshalReceipt(tx *core.RawTx, receipt *core.Receipt) map[string]interface{} {
+	logs := receipt.Logs
+	if logs == nil {
+		logs = []*types.Log{}
 	}
-
-	// Si en algún punto calculas "from" mediante firma, puedes agregarlo:
-	// "from": "0x..."
-	// (Por defecto Ethereum no lo decodifica del RLP, sino de la firma.)
-
-	return receipt, nil
+	fields := map[string]interface{}{
+		"transactionHash":   receipt.TxHash.Hex(),
+		"transactionIndex":  "0x" + strconv.FormatUint(uint64(receipt.TransactionIndex), 16),
+		"blockHash":         receipt.BlockHash.Hex(),
+		"blockNumber":       "0x" + strconv.FormatUint(receipt.BlockNumber, 16),
+		"from":              receipt.From.Hex(),
+		"to":                nil,
+		"cumulativeGasUsed": "0x" + strconv.FormatUint(receipt.CumulativeGasUsed, 16),
+		"gasUsed":           "0x" + strconv.FormatUint(receipt.GasUsed, 16),
+		"effectiveGasPrice": bigIntToHex(receipt.EffectiveGasPrice),
+		"contractAddress":   nil,
+		"logs":              logs,
+		"logsBloom":         "0x" + hex.EncodeToString(receipt.Bloom.Bytes()),
+		"status":            "0x" + strconv.FormatUint(receipt.Status, 16),
+		"type":              "0x" + strconv.FormatUint(uint64(receipt.Type), 16),
+	}
+	// Las creaciones de contrato no tienen "to" pero sí contractAddress
+	if tx.To != nil {
+		fields["to"] = tx.To.Hex()
+	} else {
+		fields["contractAddress"] = receipt.ContractAddress.Hex()
+	}
+	return fields
 }
+
 func bigIntToHex(x *big.Int) string {
 	if x == nil {
 		return "0x0"
@@ -162,44 +240,192 @@ func bigIntToHex(x *big.Int) string {
 	// Si x > 0 => "0x<hex>"
 	return "0x" + x.Text(16)
 }
-func findTransactionByHash(srv *RPCServer, hashBytes []byte) (int, int, *core.RawTx) {
-	wantedHash := common.BytesToHash(hashBytes)
-
-	fmt.Println("Find wantedHash", wantedHash)
-	fmt.Printf("Blockchain size: %d \n", len(srv.Blockchain))
-	for bIndex, block := range srv.Blockchain {
-		fmt.Println("Find block", bIndex)
-		fmt.Printf("Transactions size: %d \n", len(block.Transactions))
-		for tIndex, tx := range block.Transactions {
-			txHash := common.BytesToHash(RawTxHash(tx))
-			//txHash := tx.
-			fmt.Println("found txHash ", txHash)
-			if txHash == wantedHash {
-				return bIndex, tIndex, tx
+
+// defaultTipCap es la propina sugerida cuando no hay transacciones recientes (1 gwei)
+var defaultTipCap = big.NewInt(1_000_000_000)
+
+// maxFeeHistory es el máximo de bloques que devuelve eth_feeHistory
+const maxFeeHistory = 1024
+
+// HandleGasPrice sugiere un gasPrice: la base fee del próximo bloque más la
+// propina mediana pagada en los últimos bloques.
+func HandleGasPrice(srv *RPCServer, params []interface{}) (string, error) {
+	head := srv.Blockchain.CurrentBlock()
+	price := new(big.Int).Add(core.CalcBaseFee(head.Header), suggestTipCap(srv, 20))
+	return bigIntToHex(price), nil
+}
+
+// suggestTipCap devuelve la mediana de las propinas efectivas de los últimos `blocks` bloques.
+func suggestTipCap(srv *RPCServer, blocks uint64) *big.Int {
+	var tips []*big.Int
+	head := srv.Blockchain.CurrentBlock().Header.BlockNumber
+	for n := head; n+blocks > head; n-- {
+		block := srv.Blockchain.GetBlockByNumber(n)
+		for _, tx := range block.Transactions {
+			tips = append(tips, effectiveTip(tx, block.Header.BaseFee))
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if len(tips) == 0 {
+		return new(big.Int).Set(defaultTipCap)
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+	return tips[len(tips)/2]
+}
+
+func effectiveTip(tx *core.RawTx, baseFee *big.Int) *big.Int {
+	tip := tx.EffectiveGasPrice(baseFee)
+	if baseFee != nil {
+		tip.Sub(tip, baseFee)
+	}
+	return tip
+}
+
+// HandleFeeHistory implementa eth_feeHistory(blockCount, newestBlock, rewardPercentiles):
+// base fee, ratio de gas usado y propinas por percentil de un rango de bloques.
+func HandleFeeHistory(srv *RPCServer, params []interface{}) (interface{}, error) {
+	if len(params) < 2 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	blockCount, err := parseQuantity(params[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid block count: %v", err)
+	}
+	if blockCount > maxFeeHistory {
+		blockCount = maxFeeHistory
+	}
+	newest, err := parseBlockNumber(srv, params[1])
+	if err != nil {
+		return nil, err
+	}
+	var percentiles []float64
+	if len(params) > 2 && params[2] != nil {
+		list, ok := params[2].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid reward percentiles")
+		}
+		for i, p := range list {
+			f, ok := p.(float64)
+			if !ok || f < 0 || f > 100 || (i > 0 && f < percentiles[i-1]) {
+				return nil, fmt.Errorf("invalid reward percentile: %v", p)
 			}
+			percentiles = append(percentiles, f)
 		}
 	}
-	return -1, -1, nil
-}
-func RawTxHash(tx *core.RawTx) []byte {
-	// O usar rlp.EncodeToBytes(...)
-	// Para ejemplo, supongamos un keccak256 de:
-	// nonce + to + value
-	toBytes := tx.To.Bytes()
-	data := append(
-		append(
-			common.BigToHash(new(big.Int).SetUint64(tx.Nonce)).Bytes(),
-			toBytes...,
-		),
-		tx.Value.Bytes()...,
+	if blockCount == 0 {
+		return map[string]interface{}{"oldestBlock": "0x0"}, nil
+	}
+	if blockCount > newest+1 {
+		blockCount = newest + 1
+	}
+	oldest := newest + 1 - blockCount
+
+	var (
+		baseFees  []string
+		gasRatios []float64
+		rewards   [][]string
 	)
-	h := crypto.Keccak256Hash(data)
-	return h.Bytes()
+	for n := oldest; n <= newest; n++ {
+		block := srv.Blockchain.GetBlockByNumber(n)
+		baseFees = append(baseFees, bigIntToHex(block.Header.BaseFee))
+		gasRatios = append(gasRatios, float64(block.Header.GasUsed)/float64(block.Header.GasLimit))
+		if percentiles != nil {
+			rewards = append(rewards, blockRewards(block, srv.Blockchain.GetReceipts(block.Hash()), percentiles))
+		}
+	}
+	// La última base fee es la del bloque siguiente al más nuevo
+	baseFees = append(baseFees, bigIntToHex(core.CalcBaseFee(srv.Blockchain.GetBlockByNumber(newest).Header)))
+
+	result := map[string]interface{}{
+		"oldestBlock":   "0x" + strconv.FormatUint(oldest, 16),
+		"baseFeePerGas": baseFees,
+		"gasUsedRatio":  gasRatios,
+	}
+	if percentiles != nil {
+		result["reward"] = rewards
+	}
+	return result, nil
+}
+
+// blockRewards calcula, para cada percentil, la propina pagada en el bloque
+// ponderando cada transacción por el gas que consumió (como geth).
+func blockRewards(block *core.Block, receipts core.Receipts, percentiles []float64) []string {
+	rewards := make([]string, len(percentiles))
+	if len(block.Transactions) == 0 || len(receipts) != len(block.Transactions) {
+		for i := range rewards {
+			rewards[i] = "0x0"
+		}
+		return rewards
+	}
+	type txGasAndReward struct {
+		gasUsed uint64
+		reward  *big.Int
+	}
+	sorted := make([]txGasAndReward, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		sorted[i] = txGasAndReward{receipts[i].GasUsed, effectiveTip(tx, block.Header.BaseFee)}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].reward.Cmp(sorted[j].reward) < 0 })
+
+	var txIndex int
+	sumGasUsed := sorted[0].gasUsed
+	for i, p := range percentiles {
+		thresholdGasUsed := uint64(float64(block.Header.GasUsed) * p / 100)
+		for sumGasUsed < thresholdGasUsed && txIndex < len(sorted)-1 {
+			txIndex++
+			sumGasUsed += sorted[txIndex].gasUsed
+		}
+		rewards[i] = bigIntToHex(sorted[txIndex].reward)
+	}
+	return rewards
 }
 
-/*
-func calculateTxHash(rawTx *core.RawTx) common.Hash {
+// parseQuantity acepta un número JSON o un string hex "0x..."
+func parseQuantity(param interface{}) (uint64, error) {
+	switch v := param.(type) {
+	case float64:
+		return uint64(v), nil
+	case string:
+		return strconv.ParseUint(strings.TrimPrefix(v, "0x"), 16, 64)
+	}
+	return 0, fmt.Errorf("invalid quantity %v", param)
+}
+
+// parseBlockNumber resuelve una etiqueta ("latest", "earliest"...), un número
+// hex o un número JSON a un número de bloque canónico existente.
+func parseBlockNumber(srv *RPCServer, param interface{}) (uint64, error) {
+	if s, ok := param.(string); ok {
+		block, err := blockByNumber(srv.Blockchain, s)
+		if err != nil {
+			return 0, err
+		}
+		return block.Header.BlockNumber, nil
+	}
+	head := srv.Blockchain.CurrentBlock().Header.BlockNumber
+	n, err := parseQuantity(param)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block param: %v", param)
+	}
+	if n > head {
+		return 0, fmt.Errorf("block #%d not found", n)
+	}
+	return n, nil
+}
 
-	encoded, _ := rlp.EncodeToBytes(rawTx)
-	return common.BytesToHash(crypto.Keccak256(encoded))
-}*/
+// parseAddress valida una dirección recibida por RPC. Se acepta en minúsculas
+// o en mayúsculas, pero si mezcla ambas debe llevar un checksum EIP-55
+// correcto: así una errata en una dirección copiada no pasa desapercibida.
+func parseAddress(param interface{}) (common.Address, error) {
+	s, ok := param.(string)
+	if !ok || !strings.HasPrefix(s, "0x") || !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid address param: %v", param)
+	}
+	address := common.HexToAddress(s)
+	digits := s[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && s != address.Hex() {
+		return common.Address{}, fmt.Errorf("invalid EIP-55 checksum for address %s", s)
+	}
+	return address, nil
+}
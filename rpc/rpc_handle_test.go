@@ -0,0 +1,231 @@
+// rpc/rpc_handle_test.go
+package rpc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestGetTransactionCountPending comprueba que "pending" cuenta las TXs que
+// esperan en el pool y "latest" solo las selladas.
+func TestGetTransactionCountPending(t *testing.T) {
+	n := newTestNode(t, 1)
+	key := n.keys[0]
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	for _, client := range []rpcClient{n.httpClient(), n.wsClient(t)} {
+		nonce := func(tag string) uint64 {
+			t.Helper()
+			resp, err := client.call("eth_getTransactionCount", addr, tag)
+			return resultUint64(t, resp, err)
+		}
+		sealed := nonce("latest")
+		for i := uint64(0); i < 3; i++ {
+			if resp, err := client.call("eth_sendRawTransaction", signedTransfer(key, sealed+i, recipient, 1)); err != nil || resp.Error != nil {
+				t.Fatalf("send nonce %d: %v %v", sealed+i, err, resp.Error)
+			}
+		}
+		if have, want := nonce("latest"), sealed; have != want {
+			t.Fatalf("latest nonce with pooled txs: have %d, want %d", have, want)
+		}
+		if have, want := nonce("pending"), sealed+3; have != want {
+			t.Fatalf("pending nonce: have %d, want %d", have, want)
+		}
+
+		if _, err := n.producer.ProduceBlock(); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := nonce("latest"), sealed+3; have != want {
+			t.Fatalf("latest nonce after sealing: have %d, want %d", have, want)
+		}
+		if have, want := nonce("pending"), sealed+3; have != want {
+			t.Fatalf("pending nonce with an empty pool: have %d, want %d", have, want)
+		}
+	}
+}
+
+// TestGetTransactionCountPendingGap comprueba que "pending" se para en el
+// primer hueco de nonces del pool: las TXs de detrás no se pueden ejecutar.
+func TestGetTransactionCountPendingGap(t *testing.T) {
+	n := newTestNode(t, 1)
+	key := n.keys[0]
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	client := n.httpClient()
+	send := func(nonces ...uint64) {
+		t.Helper()
+		for _, nonce := range nonces {
+			if resp, err := client.call("eth_sendRawTransaction", signedTransfer(key, nonce, recipient, 1)); err != nil || resp.Error != nil {
+				t.Fatalf("send nonce %d: %v %v", nonce, err, resp.Error)
+			}
+		}
+	}
+	nonce := func(tag string) uint64 {
+		t.Helper()
+		resp, err := client.call("eth_getTransactionCount", addr, tag)
+		return resultUint64(t, resp, err)
+	}
+
+	send(0, 1, 5)
+	if have, want := nonce("pending"), uint64(2); have != want {
+		t.Fatalf("pending nonce with a gap: have %d, want %d", have, want)
+	}
+	if have := nonce("latest"); have != 0 {
+		t.Fatalf("latest nonce: have %d, want 0", have)
+	}
+	// Al rellenar el hueco cuenta hasta la última
+	send(2, 3, 4)
+	if have, want := nonce("pending"), uint64(6); have != want {
+		t.Fatalf("pending nonce with the gap filled: have %d, want %d", have, want)
+	}
+}
+
+// TestFeeHistory comprueba el rango, las base fees (una más que bloques: la
+// del siguiente) y el ratio de gas de eth_feeHistory, y que eth_gasPrice
+// suma a la próxima base fee la propina mediana.
+func TestFeeHistory(t *testing.T) {
+	n := newTestNode(t, 1)
+	key := n.keys[0]
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	// #1 con tres transferencias y #2 con una; signedTransfer paga 1 gwei de propina
+	var nonce uint64
+	for _, txs := range []int{3, 1} {
+		for i := 0; i < txs; i++ {
+			if resp, err := n.httpClient().call("eth_sendRawTransaction", signedTransfer(key, nonce, recipient, 1)); err != nil || resp.Error != nil {
+				t.Fatalf("send nonce %d: %v %v", nonce, err, resp.Error)
+			}
+			nonce++
+		}
+		if _, err := n.producer.ProduceBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head := n.bc.CurrentBlock()
+	if head.Header.BlockNumber != 2 {
+		t.Fatalf("head #%d, want #2", head.Header.BlockNumber)
+	}
+
+	for _, tt := range []struct {
+		count  string
+		oldest uint64
+	}{
+		{"0x2", 1},
+		{"0x64", 0}, // más bloques de los que hay: empieza en el génesis
+	} {
+		resp, err := n.httpClient().call("eth_feeHistory", tt.count, "latest", []interface{}{50.0})
+		if err != nil || resp.Error != nil {
+			t.Fatalf("eth_feeHistory(%s): %v %v", tt.count, err, resp.Error)
+		}
+		result := resp.Result.(map[string]interface{})
+		if have := hexutil.MustDecodeUint64(result["oldestBlock"].(string)); have != tt.oldest {
+			t.Fatalf("eth_feeHistory(%s) oldestBlock %d, want %d", tt.count, have, tt.oldest)
+		}
+		blocks := int(head.Header.BlockNumber - tt.oldest + 1)
+		baseFees, ratios := result["baseFeePerGas"].([]interface{}), result["gasUsedRatio"].([]interface{})
+		rewards := result["reward"].([]interface{})
+		if len(baseFees) != blocks+1 || len(ratios) != blocks || len(rewards) != blocks {
+			t.Fatalf("eth_feeHistory(%s): %d base fees, %d ratios, %d rewards for %d blocks",
+				tt.count, len(baseFees), len(ratios), len(rewards), blocks)
+		}
+		for i := 0; i < blocks; i++ {
+			header := n.bc.GetBlockByNumber(tt.oldest + uint64(i)).Header
+			if have := hexutil.MustDecodeBig(baseFees[i].(string)); have.Cmp(header.BaseFee) != 0 {
+				t.Fatalf("base fee of #%d: have %v, want %v", header.BlockNumber, have, header.BaseFee)
+			}
+			if have, want := ratios[i].(float64), float64(header.GasUsed)/float64(header.GasLimit); have != want {
+				t.Fatalf("gas used ratio of #%d: have %v, want %v", header.BlockNumber, have, want)
+			}
+		}
+		if have, want := hexutil.MustDecodeBig(baseFees[blocks].(string)), core.CalcBaseFee(head.Header); have.Cmp(want) != 0 {
+			t.Fatalf("next base fee: have %v, want %v", have, want)
+		}
+		if have := hexutil.MustDecodeBig(rewards[blocks-1].([]interface{})[0].(string)); have.Int64() != 1e9 {
+			t.Fatalf("median tip of the head: have %v, want 1 gwei", have)
+		}
+	}
+
+	resp, err := n.httpClient().call("eth_gasPrice")
+	if err != nil || resp.Error != nil {
+		t.Fatalf("eth_gasPrice: %v %v", err, resp.Error)
+	}
+	want := new(big.Int).Add(core.CalcBaseFee(head.Header), big.NewInt(1e9))
+	if have := hexutil.MustDecodeBig(resp.Result.(string)); have.Cmp(want) != 0 {
+		t.Fatalf("eth_gasPrice: have %v, want %v", have, want)
+	}
+}
+
+// TestDeployAndCall despliega un contrato con eth_sendRawTransaction y lo lee
+// con eth_getTransactionReceipt, eth_getStorageAt y eth_call. El constructor
+// guarda 0x2a en el slot 0 y el código devuelve ese slot.
+func TestDeployAndCall(t *testing.T) {
+	n := newTestNode(t, 1)
+	key := n.keys[0]
+	initCode := common.FromHex("602a600055" + "600b6011600039600b6000f3" + "60005460005260206000f3")
+	contract := crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), 0)
+	want := common.HexToHash("0x2a").Hex()
+
+	call := func(client rpcClient, method string, params ...interface{}) interface{} {
+		t.Helper()
+		resp, err := client.call(method, params...)
+		if err != nil || resp.Error != nil {
+			t.Fatalf("%s: %v %v", method, err, resp.Error)
+		}
+		return resp.Result
+	}
+	txHash := call(n.httpClient(), "eth_sendRawTransaction", signedTx(key, 0, nil, 0, 200000, initCode))
+	if _, err := n.producer.ProduceBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range []rpcClient{n.httpClient(), n.wsClient(t)} {
+		receipt := call(client, "eth_getTransactionReceipt", txHash).(map[string]interface{})
+		if receipt["status"] != "0x1" || receipt["to"] != nil || receipt["contractAddress"] != contract.Hex() {
+			t.Fatalf("deploy receipt: status %v, to %v, contractAddress %v, want %s",
+				receipt["status"], receipt["to"], receipt["contractAddress"], contract.Hex())
+		}
+		if have := call(client, "eth_getStorageAt", contract.Hex(), "0x0", "latest"); have != want {
+			t.Fatalf("eth_getStorageAt: have %v, want %s", have, want)
+		}
+		if have := call(client, "eth_call", map[string]interface{}{"to": contract.Hex(), "data": "0x"}, "latest"); have != want {
+			t.Fatalf("eth_call: have %v, want %s", have, want)
+		}
+		// Antes del despliegue no hay código: la llamada no devuelve nada
+		if have := call(client, "eth_call", map[string]interface{}{"to": contract.Hex()}, "earliest"); have != "0x" {
+			t.Fatalf("eth_call before the deploy: have %v, want 0x", have)
+		}
+		if have := call(client, "eth_getStorageAt", contract.Hex(), "0x0", "earliest"); have != (common.Hash{}).Hex() {
+			t.Fatalf("eth_getStorageAt before the deploy: have %v", have)
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	want := common.HexToAddress("0x627306090abaB3A6e1400e9345bC60c78a8BEf57")
+	tests := []struct {
+		param interface{}
+		ok    bool
+	}{
+		{"0x627306090abab3a6e1400e9345bc60c78a8bef57", true},  // minúsculas
+		{"0x627306090ABAB3A6E1400E9345BC60C78A8BEF57", true},  // mayúsculas
+		{"0x627306090abaB3A6e1400e9345bC60c78a8BEf57", true},  // checksum EIP-55 correcto
+		{"0x627306090AbaB3A6e1400e9345bC60c78a8BEf57", false}, // checksum con una letra cambiada
+		{"627306090abab3a6e1400e9345bc60c78a8bef57", false},   // sin 0x
+		{"0x627306090abab3a6e1400e9345bc60c78a8bef", false},   // corta
+		{42.0, false},
+	}
+	for _, tt := range tests {
+		have, err := parseAddress(tt.param)
+		if tt.ok && (err != nil || have != want) {
+			t.Errorf("parseAddress(%v): have %s, %v", tt.param, have.Hex(), err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("parseAddress(%v) accepted", tt.param)
+		}
+	}
+}
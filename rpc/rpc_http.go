@@ -10,10 +10,10 @@ import (
 )
 
 type RPCServer struct {
-	// Podríamos tener referencia al objeto State, Blockchain, etc.
-	// Referencia a State o a la blockchain. Aquí supongamos State directamente.
-	State      *core.State
-	Blockchain []*core.Block
+	// Referencia a la blockchain, de ella sacamos también el State de la cabeza
+	Blockchain *core.Blockchain
+	// Pool donde quedan las TX enviadas hasta que se sellan en un bloque
+	TxPool *core.TxPool
 }
 
 // StartRPC arranca un servidor HTTP en el puerto indicado,
@@ -59,6 +59,41 @@ func (srv *RPCServer) handleRPC(w http.ResponseWriter, r *http.Request) {
 		} else {
 			response.Result = nonceHex
 		}
+	case "eth_getBalance":
+		balanceHex, err := HandleGetBalance(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = balanceHex
+		}
+	case "eth_getStorageAt":
+		value, err := HandleGetStorageAt(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = value
+		}
+	case "eth_call":
+		ret, err := HandleCall(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = ret
+		}
+	case "eth_getProof":
+		proof, err := HandleGetProof(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = proof
+		}
+	case "debug_stateDiff":
+		diff, err := HandleStateDiff(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = diff
+		}
 	case "eth_sendRawTransaction":
 		txHash, err := HandleSendRawTransaction(srv, req.Params)
 		if err != nil {
@@ -67,11 +102,25 @@ func (srv *RPCServer) handleRPC(w http.ResponseWriter, r *http.Request) {
 			response.Result = txHash // Retornamos un "txHash" por ejemplo
 		}
 	case "eth_getTransactionReceipt":
-		txHash, err := HandleGetTransactionReceipt(srv, req.Params)
+		receipt, err := HandleGetTransactionReceipt(srv, req.Params)
 		if err != nil {
 			response.Error = err.Error()
 		} else {
-			response.Result = txHash // Retornamos un "txHash" por ejemplo
+			response.Result = receipt
+		}
+	case "eth_gasPrice":
+		price, err := HandleGasPrice(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = price
+		}
+	case "eth_feeHistory":
+		history, err := HandleFeeHistory(srv, req.Params)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response.Result = history
 		}
 	// Otros métodos (ping, sendTransaction, etc.)
 
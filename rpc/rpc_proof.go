@@ -0,0 +1,188 @@
+// rpc/rpc_proof.go
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// AccountResult es la respuesta de eth_getProof, con el mismo formato que en
+// geth. Un cliente puede decodificar el JSON en este tipo y comprobarlo con
+// Verify sin fiarse del nodo.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []string        `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult es la prueba de un slot dentro de AccountResult.
+type StorageResult struct {
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	Proof []string     `json:"proof"`
+}
+
+// HandleGetProof devuelve la prueba Merkle de una cuenta y de los slots
+// pedidos contra el StateRoot del bloque indicado.
+// Params: [dirección, [slots...], bloque]
+func HandleGetProof(srv *RPCServer, params []interface{}) (*AccountResult, error) {
+	if len(params) < 3 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	address, err := parseAddress(params[0])
+	if err != nil {
+		return nil, err
+	}
+	keysParam, ok := params[1].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid storage keys param")
+	}
+	keys := make([]common.Hash, len(keysParam))
+	for i, k := range keysParam {
+		s, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid storage key: %v", k)
+		}
+		key, err := parseStorageKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	state, err := stateAtBlock(srv, params[2])
+	if err != nil {
+		return nil, err
+	}
+
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	result := &AccountResult{
+		Address:      address,
+		AccountProof: encodeProof(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address).ToBig()),
+		CodeHash:     types.EmptyCodeHash,
+		StorageHash:  types.EmptyRootHash,
+		StorageProof: make([]StorageResult, len(keys)),
+	}
+	acc, err := state.GetAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	if acc != nil {
+		result.CodeHash = acc.CodeHash
+		result.Nonce = hexutil.Uint64(acc.Nonce)
+		result.StorageHash = acc.StorageRoot
+	}
+	for i, key := range keys {
+		proof, err := state.GetStorageProof(address, key)
+		if err != nil {
+			return nil, err
+		}
+		value := state.GetState(address, key)
+		result.StorageProof[i] = StorageResult{
+			Key:   keysParam[i].(string),
+			Value: (*hexutil.Big)(value.Big()),
+			Proof: encodeProof(proof),
+		}
+	}
+	return result, nil
+}
+
+// parseStorageKey acepta un slot en hex de hasta 32 bytes, con o sin ceros a
+// la izquierda ("0x0", "0x01", "0x00...05"), como geth.
+func parseStorageKey(s string) (common.Hash, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return common.Hash{}, fmt.Errorf("invalid storage key %q", s)
+	}
+	digits := s[2:]
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil || len(b) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid storage key %q", s)
+	}
+	return common.BytesToHash(b), nil
+}
+
+func encodeProof(proof [][]byte) []string {
+	enc := make([]string, len(proof))
+	for i, node := range proof {
+		enc[i] = hexutil.Encode(node)
+	}
+	return enc
+}
+
+func decodeProof(proof []string) ([][]byte, error) {
+	nodes := make([][]byte, len(proof))
+	for i, node := range proof {
+		b, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node %d: %v", i, err)
+		}
+		nodes[i] = b
+	}
+	return nodes, nil
+}
+
+// Verify comprueba la respuesta de eth_getProof contra `stateRoot`, la raíz
+// de estado de una cabecera en la que el cliente confía: las pruebas deben
+// llevar desde esa raíz a exactamente la cuenta y los valores que dice el nodo.
+func (r *AccountResult) Verify(stateRoot common.Hash) error {
+	if r.Balance == nil {
+		return fmt.Errorf("missing balance for %s", r.Address.Hex())
+	}
+	proof, err := decodeProof(r.AccountProof)
+	if err != nil {
+		return err
+	}
+	acc, err := core.VerifyAccountProof(stateRoot, r.Address, proof)
+	if err != nil {
+		return err
+	}
+	balance := r.Balance.ToInt()
+	if acc == nil {
+		// La prueba demuestra que la cuenta no existe: todo debe estar vacío
+		if balance.Sign() != 0 || r.Nonce != 0 || r.StorageHash != types.EmptyRootHash ||
+			(r.CodeHash != types.EmptyCodeHash && r.CodeHash != (common.Hash{})) {
+			return fmt.Errorf("account %s does not exist but the result is not empty", r.Address.Hex())
+		}
+	} else if acc.Balance.ToBig().Cmp(balance) != 0 || uint64(r.Nonce) != acc.Nonce ||
+		r.CodeHash != acc.CodeHash || r.StorageHash != acc.StorageRoot {
+		return fmt.Errorf("account %s does not match its proof", r.Address.Hex())
+	}
+
+	for _, sr := range r.StorageProof {
+		if sr.Value == nil {
+			return fmt.Errorf("missing value for slot %s", sr.Key)
+		}
+		key, err := parseStorageKey(sr.Key)
+		if err != nil {
+			return err
+		}
+		proof, err := decodeProof(sr.Proof)
+		if err != nil {
+			return err
+		}
+		value, err := core.VerifyStorageProof(r.StorageHash, key, proof)
+		if err != nil {
+			return err
+		}
+		if value.Big().Cmp(sr.Value.ToInt()) != 0 {
+			return fmt.Errorf("slot %s of %s does not match its proof", sr.Key, r.Address.Hex())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// rpc/rpc_proof_test.go
+package rpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// getProof pide eth_getProof y lo decodifica como lo haría un cliente.
+func getProof(t *testing.T, srv *RPCServer, address common.Address, keys ...interface{}) *AccountResult {
+	t.Helper()
+	if keys == nil {
+		keys = []interface{}{}
+	}
+	result, err := HandleGetProof(srv, []interface{}{address.Hex(), keys, "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(AccountResult)
+	if err := json.Unmarshal(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestAccountResultVerify(t *testing.T) {
+	contract := common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	eoa := common.HexToAddress("0x627306090abaB3A6e1400e9345bC60c78a8BEf57")
+	genesis := core.DefaultGenesis()
+	genesis.Alloc[contract] = core.GenesisAccount{
+		Balance: big.NewInt(5),
+		Nonce:   1,
+		Code:    common.FromHex("60003560005560006000f3"),
+		Storage: map[common.Hash]common.Hash{
+			common.HexToHash("0x01"): common.HexToHash("0x2a"),
+			common.HexToHash("0x02"): common.HexToHash("0xbeef"),
+		},
+	}
+	bc, err := core.NewBlockchain(storage.NewMemoryDB(), genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &RPCServer{Blockchain: bc}
+	root := bc.CurrentBlock().Header.StateRoot
+
+	// Cuenta normal, contrato con slots (uno vacío) y cuenta inexistente
+	results := []*AccountResult{
+		getProof(t, srv, eoa),
+		getProof(t, srv, contract, "0x1", "0x02", "0x3"),
+		getProof(t, srv, common.HexToAddress("0xdead"), "0x1"),
+	}
+	for _, r := range results {
+		if err := r.Verify(root); err != nil {
+			t.Fatalf("valid proof of %s rejected: %v", r.Address.Hex(), err)
+		}
+	}
+	if got := results[1].StorageProof[0].Value.ToInt(); got.Int64() != 0x2a {
+		t.Fatalf("slot 1 value %v, want 0x2a", got)
+	}
+
+	// Cada mentira del nodo debe detectarse
+	wrongRoot := crypto.Keccak256Hash([]byte("other"))
+	for name, mutate := range map[string]func(r *AccountResult) (*AccountResult, common.Hash){
+		"wrong root": func(r *AccountResult) (*AccountResult, common.Hash) { return r, wrongRoot },
+		"wrong balance": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.Balance = (*hexutil.Big)(new(big.Int).Add(r.Balance.ToInt(), big.NewInt(1)))
+			return r, root
+		},
+		"wrong nonce": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.Nonce++
+			return r, root
+		},
+		"tampered account node": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.AccountProof[len(r.AccountProof)-1] = tamperHex(r.AccountProof[len(r.AccountProof)-1])
+			return r, root
+		},
+		"wrong slot value": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.StorageProof[0].Value = (*hexutil.Big)(big.NewInt(0x2b))
+			return r, root
+		},
+		"tampered storage node": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.StorageProof[1].Proof[0] = tamperHex(r.StorageProof[1].Proof[0])
+			return r, root
+		},
+		"empty slot claimed non-zero": func(r *AccountResult) (*AccountResult, common.Hash) {
+			r.StorageProof[2].Value = (*hexutil.Big)(big.NewInt(1))
+			return r, root
+		},
+	} {
+		r, stateRoot := mutate(getProof(t, srv, contract, "0x1", "0x02", "0x3"))
+		if err := r.Verify(stateRoot); err == nil {
+			t.Errorf("%s: Verify accepted the result", name)
+		}
+	}
+
+	// Una cuenta inexistente no puede presentarse con balance
+	absent := getProof(t, srv, common.HexToAddress("0xdead"))
+	absent.Balance = (*hexutil.Big)(big.NewInt(1))
+	if err := absent.Verify(root); err == nil {
+		t.Error("absent account with a balance accepted")
+	}
+}
+
+// tamperHex cambia el último byte de un nodo codificado en hex.
+func tamperHex(node string) string {
+	b := hexutil.MustDecode(node)
+	b[len(b)-1] ^= 0x01
+	return hexutil.Encode(b)
+}
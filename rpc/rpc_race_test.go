@@ -0,0 +1,288 @@
+// rpc/rpc_race_test.go
+package rpc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/edumar111/my-geth-edu/core"
+	"github.com/edumar111/my-geth-edu/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/websocket"
+)
+
+// rpcClient hace una llamada JSON-RPC por HTTP o por WebSocket.
+type rpcClient interface {
+	call(method string, params ...interface{}) (RPCResponse, error)
+}
+
+type httpClient struct{ url string }
+
+func (c *httpClient) call(method string, params ...interface{}) (RPCResponse, error) {
+	var resp RPCResponse
+	body, _ := json.Marshal(RPCRequest{JSONRPC: "2.0", Method: method, Params: params, ID: 1})
+	res, err := http.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	defer res.Body.Close()
+	return resp, json.NewDecoder(res.Body).Decode(&resp)
+}
+
+// wsClient no se puede usar desde varias goroutines: cada una abre la suya.
+type wsClient struct {
+	conn *websocket.Conn
+	id   int
+}
+
+func (c *wsClient) call(method string, params ...interface{}) (RPCResponse, error) {
+	var resp RPCResponse
+	c.id++
+	if err := c.conn.WriteJSON(RPCRequest{JSONRPC: "2.0", Method: method, Params: params, ID: c.id}); err != nil {
+		return resp, err
+	}
+	return resp, c.conn.ReadJSON(&resp)
+}
+
+// testNode levanta una cadena en memoria con `senders` cuentas con fondos y
+// los dos servidores RPC sobre ella. El productor no arranca: el test sella
+// los bloques llamando a ProduceBlock.
+type testNode struct {
+	bc       *core.Blockchain
+	producer *core.BlockProducer
+	keys     []*ecdsa.PrivateKey
+	http     *httptest.Server
+	ws       *httptest.Server
+}
+
+func newTestNode(t *testing.T, senders int) *testNode {
+	t.Helper()
+	prev := log.Writer()
+	log.SetOutput(io.Discard) // el pool y el productor loguean cada TX
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	genesis := core.DefaultGenesis()
+	n := &testNode{}
+	for i := 0; i < senders; i++ {
+		key, _ := crypto.GenerateKey()
+		n.keys = append(n.keys, key)
+		genesis.Alloc[crypto.PubkeyToAddress(key.PublicKey)] = core.GenesisAccount{Balance: big.NewInt(1e18)}
+	}
+	bc, err := core.NewBlockchain(storage.NewMemoryDB(), genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := core.NewTxPool(bc, core.TxPoolConfig{})
+	t.Cleanup(pool.Stop)
+	n.bc = bc
+	n.producer = core.NewBlockProducer(bc, pool, core.DefaultProducerConfig)
+
+	srv := &RPCServer{Blockchain: bc, TxPool: pool}
+	wsSrv := &RPCWSServer{Blockchain: bc, TxPool: pool}
+	n.http = httptest.NewServer(http.HandlerFunc(srv.handleRPC))
+	n.ws = httptest.NewServer(http.HandlerFunc(wsSrv.wsHandler))
+	t.Cleanup(n.http.Close)
+	t.Cleanup(n.ws.Close)
+	return n
+}
+
+func (n *testNode) httpClient() rpcClient {
+	return &httpClient{url: n.http.URL}
+}
+
+func (n *testNode) wsClient(t *testing.T) rpcClient {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(n.ws.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{conn: conn}
+}
+
+// signedTransfer firma una transferencia EIP-1559 de `value` wei y la
+// devuelve codificada para eth_sendRawTransaction.
+func signedTransfer(key *ecdsa.PrivateKey, nonce uint64, to common.Address, value int64) string {
+	return signedTx(key, nonce, &to, value, 21000, nil)
+}
+
+// signedTx firma una TX EIP-1559 cualquiera; sin `to` despliega `data`.
+func signedTx(key *ecdsa.PrivateKey, nonce uint64, to *common.Address, value int64, gas int64, data []byte) string {
+	chainID := big.NewInt(core.DefaultChainID)
+	tx := &core.RawTx{
+		Type:      core.DynamicFeeTxType,
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(100e9),
+		GasLimit:  big.NewInt(gas),
+		To:        to,
+		Value:     big.NewInt(value),
+		Data:      data,
+	}
+	sig, err := crypto.Sign(tx.SigningHash(chainID).Bytes(), key)
+	if err != nil {
+		panic(err)
+	}
+	tx.R = new(big.Int).SetBytes(sig[:32])
+	tx.S = new(big.Int).SetBytes(sig[32:64])
+	tx.V = new(big.Int).SetBytes(sig[64:])
+	enc, _ := tx.MarshalBinary()
+	return hexutil.Encode(enc)
+}
+
+func resultUint64(t *testing.T, resp RPCResponse, err error) uint64 {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := resp.Result.(string)
+	if !ok {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	n, err := hexutil.DecodeUint64(s)
+	if err != nil {
+		t.Fatalf("bad quantity %q: %v", s, err)
+	}
+	return n
+}
+
+// TestRPCConcurrentServers envía transacciones y consultas a la vez por HTTP
+// y por WebSocket mientras se sellan bloques. Con -race cualquier acceso al
+// estado fuera de su lock falla; al final todas las transacciones deben estar
+// en la cadena exactamente una vez.
+func TestRPCConcurrentServers(t *testing.T) {
+	const (
+		senders   = 4
+		perSender = 20
+	)
+	n := newTestNode(t, senders)
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+
+	// Productor: sella bloques sin parar mientras llegan transacciones
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := n.producer.ProduceBlock(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// Lectores: consultas de estado por los dos servidores
+	for r := 0; r < 4; r++ {
+		var client rpcClient = n.httpClient()
+		if r%2 == 1 {
+			client = n.wsClient(t)
+		}
+		background.Add(1)
+		go func(client rpcClient) {
+			defer background.Done()
+			addr := strings.ToLower(recipient.Hex())
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, req := range []struct {
+					method string
+					params []interface{}
+				}{
+					{"eth_getBalance", []interface{}{addr, "latest"}},
+					{"eth_getTransactionCount", []interface{}{addr, "pending"}},
+					{"eth_getProof", []interface{}{addr, []interface{}{"0x0"}, "latest"}},
+					{"eth_getBalance", []interface{}{addr, "earliest"}},
+					{"debug_stateDiff", []interface{}{"latest"}},
+					{"eth_gasPrice", nil},
+					{"eth_feeHistory", []interface{}{"0x4", "latest", []interface{}{50.0}}},
+				} {
+					resp, err := client.call(req.method, req.params...)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if resp.Error != nil {
+						t.Errorf("%s: %v", req.method, resp.Error)
+						return
+					}
+				}
+			}
+		}(client)
+	}
+
+	// Emisores: cada cuenta alterna HTTP y WebSocket
+	var senderWG sync.WaitGroup
+	for i, key := range n.keys {
+		httpC, wsC := n.httpClient(), n.wsClient(t)
+		senderWG.Add(1)
+		go func(i int, key *ecdsa.PrivateKey) {
+			defer senderWG.Done()
+			for nonce := uint64(0); nonce < perSender; nonce++ {
+				client := httpC
+				if (i+int(nonce))%2 == 1 {
+					client = wsC
+				}
+				resp, err := client.call("eth_sendRawTransaction", signedTransfer(key, nonce, recipient, 1))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if resp.Error != nil {
+					t.Errorf("sender %d nonce %d: %v", i, nonce, resp.Error)
+					return
+				}
+			}
+		}(i, key)
+	}
+	senderWG.Wait()
+	close(stop)
+	background.Wait()
+	if t.Failed() {
+		return
+	}
+
+	// Sellamos lo que quede en el pool
+	for i := 0; i < perSender; i++ {
+		block, err := n.producer.ProduceBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block == nil {
+			break
+		}
+	}
+
+	client := n.httpClient()
+	for i, key := range n.keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+		resp, err := client.call("eth_getTransactionCount", addr, "latest")
+		if nonce := resultUint64(t, resp, err); nonce != perSender {
+			t.Errorf("sender %d: nonce %d, want %d", i, nonce, perSender)
+		}
+	}
+	resp, err := client.call("eth_getBalance", recipient.Hex(), "latest")
+	if balance := resultUint64(t, resp, err); balance != senders*perSender {
+		t.Errorf("recipient balance %d, want %d", balance, senders*perSender)
+	}
+}
@@ -27,9 +27,9 @@ type RPCResponse struct {
 	ID      int         `json:"id"`
 }
 type RPCWSServer struct {
-	// Aquí también podemos almacenar un State o Blockchain
-	State      *core.State
-	Blockchain []*core.Block
+	// La misma blockchain y el mismo pool que usa el servidor HTTP
+	Blockchain *core.Blockchain
+	TxPool     *core.TxPool
 }
 
 // Inicia el servidor WebSocket
@@ -88,8 +88,8 @@ func (wsServer *RPCWSServer) handleConnection(conn *websocket.Conn) {
 			ID:      request.ID,
 		}
 		nodoRPC := &RPCServer{
-			State:      wsServer.State,
 			Blockchain: wsServer.Blockchain,
+			TxPool:     wsServer.TxPool,
 		}
 		switch request.Method {
 		case "ping":
@@ -102,6 +102,41 @@ func (wsServer *RPCWSServer) handleConnection(conn *websocket.Conn) {
 			} else {
 				response.Result = nonceHex
 			}
+		case "eth_getBalance":
+			balanceHex, err := HandleGetBalance(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = balanceHex
+			}
+		case "eth_getStorageAt":
+			value, err := HandleGetStorageAt(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = value
+			}
+		case "eth_call":
+			ret, err := HandleCall(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = ret
+			}
+		case "eth_getProof":
+			proof, err := HandleGetProof(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = proof
+			}
+		case "debug_stateDiff":
+			diff, err := HandleStateDiff(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = diff
+			}
 		case "eth_sendRawTransaction":
 			txHash, err := HandleSendRawTransaction(nodoRPC, request.Params)
 			if err != nil {
@@ -110,11 +145,25 @@ func (wsServer *RPCWSServer) handleConnection(conn *websocket.Conn) {
 				response.Result = txHash
 			}
 		case "eth_getTransactionReceipt":
-			txHash, err := HandleSendRawTransaction(nodoRPC, request.Params)
+			receipt, err := HandleGetTransactionReceipt(nodoRPC, request.Params)
 			if err != nil {
 				response.Error = err.Error()
 			} else {
-				response.Result = txHash
+				response.Result = receipt
+			}
+		case "eth_gasPrice":
+			price, err := HandleGasPrice(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = price
+			}
+		case "eth_feeHistory":
+			history, err := HandleFeeHistory(nodoRPC, request.Params)
+			if err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Result = history
 			}
 		default:
 			response.Error = fmt.Sprintf("Method '%s' not found", request.Method)
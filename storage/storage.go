@@ -0,0 +1,49 @@
+// storage/storage.go
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+const (
+	// chainDataDir es el subdirectorio del datadir donde vive la base de datos
+	chainDataDir = "chaindata"
+
+	levelDBCache   = 16 // MB de caché de LevelDB
+	levelDBHandles = 16 // ficheros abiertos a la vez
+)
+
+// KeyValueStore es la base de datos clave-valor donde el nodo guarda bloques,
+// recibos, nodos de la trie de estado e índices. Es la misma interfaz que usa
+// geth (Get/Put/Delete, batches e iteradores), así las tries de go-ethereum
+// pueden leer y escribir sus nodos directamente en ella.
+type KeyValueStore = ethdb.KeyValueStore
+
+// NewMemoryDB crea una base de datos en memoria: se pierde al cerrar el nodo,
+// útil para pruebas y para nodos efímeros.
+func NewMemoryDB() KeyValueStore {
+	return memorydb.New()
+}
+
+// NewLevelDB abre (o crea) una base de datos LevelDB embebida en `path`.
+func NewLevelDB(path string) (KeyValueStore, error) {
+	db, err := leveldb.New(path, levelDBCache, levelDBHandles, "mini-eth/db/", false)
+	if err != nil {
+		return nil, fmt.Errorf("open leveldb at %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Open abre la base de datos del nodo dentro de `datadir`. Con un datadir
+// vacío se usa una base de datos en memoria.
+func Open(datadir string) (KeyValueStore, error) {
+	if datadir == "" {
+		return NewMemoryDB(), nil
+	}
+	return NewLevelDB(filepath.Join(datadir, chainDataDir))
+}